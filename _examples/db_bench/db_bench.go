@@ -9,6 +9,7 @@ import (
 	"os"
 	"runtime"
 	"runtime/pprof"
+	"sync"
 	"time"
 
 	"github.com/robaho/leveldb"
@@ -47,6 +48,12 @@ func main() {
 
 	testWrite(false, true)
 	testWrite(true, true)
+	for _, writers := range []int{1, 2, 4, 8} {
+		testWriteConcurrent(false, writers)
+	}
+	for _, writers := range []int{1, 2, 4, 8} {
+		testWriteConcurrent(true, writers)
+	}
 	testBatch()
 	testWrite(false, false)
 	testRead()
@@ -106,6 +113,56 @@ func testWrite(sync bool, remove bool) {
 	fmt.Println("database size ", dbsize("test/mydb"))
 }
 
+// testWriteConcurrent writes the records using multiple writer goroutines, each writing an interleaved subset of the keys
+func testWriteConcurrent(syncWrite bool, writers int) {
+	leveldb.Remove(dbname)
+
+	db, err := leveldb.Open(dbname, leveldb.Options{CreateIfNeeded: true, EnableSyncWrite: syncWrite, MaxSegments: 64})
+	if err != nil {
+		log.Fatal("unable to create database", err)
+	}
+
+	n := nr
+	if syncWrite {
+		n = n / 100
+	}
+
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < n; i += writers {
+				key := make([]byte, kSize)
+				keyS := []byte(fmt.Sprintf("%07d.........", i))
+				copy(key, keyS)
+				err := db.Put(key, value)
+				if err != nil {
+					panic(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	end := time.Now()
+	duration := end.Sub(start).Microseconds()
+
+	mode := "no-sync"
+	if syncWrite {
+		mode = "sync"
+	}
+
+	fmt.Println("write", mode, "concurrent", writers, "writers time", n, "records =", duration/1000, "ms, usec per op", float64(duration)/float64(n))
+
+	err = db.Close()
+	if err != nil {
+		panic(err)
+	}
+}
+
 func testBatch() {
 	leveldb.Remove(dbname)
 
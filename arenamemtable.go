@@ -0,0 +1,278 @@
+package leveldb
+
+import (
+	"bytes"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+const arenaMaxHeight = 12
+const arenaBranching = 4
+
+// length of a nil value, which is distinct from an empty value
+const arenaNilValue = 0xFFFFFFFF
+
+// arenaMemtable is a concurrent skip list which stores the keys, values and links in large blocks, using offsets
+// rather than pointers, so the garbage collector neither tracks nor scans the individual entries.
+//
+// An address is the block index in the upper 32 bits, and the byte offset within the block in the lower 32 bits.
+// A node is { entry address, height, next address for each level } and an entry is { seq, key length << 32 | value
+// length, key bytes, value bytes }. Nodes and entries are 8 byte aligned so the addresses are updated atomically,
+// and a key is replaced by storing the address of a new entry in the node. The head node is at address 0, so
+// a next address of 0 is the end of the list.
+type arenaMemtable struct {
+	cmp       func(a, b []byte) int
+	blockSize int
+	// protects allocation, the blocks are read without locking
+	mu     sync.Mutex
+	blocks atomic.Pointer[[][]uint64]
+	// number of words used in the last block
+	offset int
+	// bytes of the blocks that are used, including the space wasted at the end of the full blocks, atomically updated
+	used      uint64
+	maxHeight int32
+}
+
+func newArenaMemtable(options Options) *arenaMemtable {
+	t := &arenaMemtable{cmp: bytes.Compare, maxHeight: 1}
+	if options.UserKeyCompare != nil {
+		t.cmp = options.UserKeyCompare
+	}
+	// use blocks of 1/8 of the memory segment size, to limit the space wasted by the last block
+	t.blockSize = int(options.MaxMemoryBytes / 8)
+	if t.blockSize < 64*1024 {
+		t.blockSize = 64 * 1024
+	} else if t.blockSize > 8*1024*1024 {
+		t.blockSize = 8 * 1024 * 1024
+	}
+	t.blocks.Store(&[][]uint64{})
+	t.newNode(0, arenaMaxHeight)
+	return t
+}
+
+// alloc returns the address of n bytes, rounded up to a multiple of 8
+func (t *arenaMemtable) alloc(n int) uint64 {
+	words := (n + 7) / 8
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	blocks := *t.blocks.Load()
+	if len(blocks) == 0 || t.offset+words > len(blocks[len(blocks)-1]) {
+		if len(blocks) > 0 {
+			atomic.AddUint64(&t.used, uint64((len(blocks[len(blocks)-1])-t.offset)*8))
+		}
+		size := t.blockSize / 8
+		if words > size {
+			size = words
+		}
+		blocks = append(blocks[:len(blocks):len(blocks)], make([]uint64, size))
+		t.blocks.Store(&blocks)
+		t.offset = 0
+	}
+	addr := uint64(len(blocks)-1)<<32 | uint64(t.offset*8)
+	t.offset += words
+	atomic.AddUint64(&t.used, uint64(words*8))
+	return addr
+}
+
+func (t *arenaMemtable) word(addr uint64) *uint64 {
+	block := (*t.blocks.Load())[addr>>32]
+	return &block[(addr&0xFFFFFFFF)/8]
+}
+
+func (t *arenaMemtable) bytes(addr uint64, n int) []byte {
+	block := (*t.blocks.Load())[addr>>32]
+	b := unsafe.Slice((*byte)(unsafe.Pointer(&block[0])), len(block)*8)
+	offset := int(addr & 0xFFFFFFFF)
+	return b[offset : offset+n : offset+n]
+}
+
+func (t *arenaMemtable) newEntry(kv KeyValue, seq uint64) uint64 {
+	valueLen := uint64(len(kv.value))
+	if kv.value == nil {
+		valueLen = arenaNilValue
+	}
+	addr := t.alloc(16 + len(kv.key) + len(kv.value))
+	*t.word(addr) = seq
+	*t.word(addr + 8) = uint64(len(kv.key))<<32 | valueLen
+	copy(t.bytes(addr+16, len(kv.key)), kv.key)
+	copy(t.bytes(addr+16+uint64(len(kv.key)), len(kv.value)), kv.value)
+	return addr
+}
+
+func (t *arenaMemtable) entryKey(entry uint64) []byte {
+	lengths := *t.word(entry + 8)
+	return t.bytes(entry+16, int(lengths>>32))
+}
+
+// entryKeyValue returns the key and value of the entry, which reference the arena
+func (t *arenaMemtable) entryKeyValue(entry uint64) KeyValue {
+	lengths := *t.word(entry + 8)
+	keyLen, valueLen := lengths>>32, lengths&0xFFFFFFFF
+	kv := KeyValue{key: t.bytes(entry+16, int(keyLen))}
+	if valueLen != arenaNilValue {
+		kv.value = t.bytes(entry+16+keyLen, int(valueLen))
+	}
+	return kv
+}
+
+func (t *arenaMemtable) newNode(entry uint64, height int) uint64 {
+	addr := t.alloc(8 * (2 + height))
+	*t.word(addr) = entry
+	*t.word(addr + 8) = uint64(height)
+	return addr
+}
+
+func (t *arenaMemtable) entry(node uint64) uint64 {
+	return atomic.LoadUint64(t.word(node))
+}
+
+func (t *arenaMemtable) nodeKey(node uint64) []byte {
+	return t.entryKey(t.entry(node))
+}
+
+func (t *arenaMemtable) next(node uint64, level int) uint64 {
+	return atomic.LoadUint64(t.word(node + 16 + 8*uint64(level)))
+}
+
+func (t *arenaMemtable) setNext(node uint64, level int, next uint64) {
+	atomic.StoreUint64(t.word(node+16+8*uint64(level)), next)
+}
+
+func (t *arenaMemtable) casNext(node uint64, level int, old uint64, next uint64) bool {
+	return atomic.CompareAndSwapUint64(t.word(node+16+8*uint64(level)), old, next)
+}
+
+func (t *arenaMemtable) keyIsAfterNode(key []byte, node uint64) bool {
+	return node != 0 && t.cmp(t.nodeKey(node), key) < 0
+}
+
+func (t *arenaMemtable) randomHeight() int {
+	height := 1
+	for height < arenaMaxHeight && rand.Intn(arenaBranching) == 0 {
+		height++
+	}
+	return height
+}
+
+// findSpliceForLevel returns the last node before key and the node after it at level, starting from before
+func (t *arenaMemtable) findSpliceForLevel(key []byte, before uint64, level int) (uint64, uint64) {
+	for {
+		next := t.next(before, level)
+		if !t.keyIsAfterNode(key, next) {
+			return before, next
+		}
+		before = next
+	}
+}
+
+func (t *arenaMemtable) findGreaterOrEqual(key []byte) uint64 {
+	x := uint64(0)
+	for level := int(atomic.LoadInt32(&t.maxHeight)) - 1; level >= 0; level-- {
+		x, _ = t.findSpliceForLevel(key, x, level)
+	}
+	return t.next(x, 0)
+}
+
+func (t *arenaMemtable) put(kv KeyValue, seq uint64) bool {
+	height := t.randomHeight()
+	maxHeight := int(atomic.LoadInt32(&t.maxHeight))
+	for height > maxHeight {
+		if atomic.CompareAndSwapInt32(&t.maxHeight, int32(maxHeight), int32(height)) {
+			maxHeight = height
+			break
+		}
+		maxHeight = int(atomic.LoadInt32(&t.maxHeight))
+	}
+
+	var prev, next [arenaMaxHeight]uint64
+	x := uint64(0)
+	for level := maxHeight - 1; level >= 0; level-- {
+		prev[level], next[level] = t.findSpliceForLevel(kv.key, x, level)
+		x = prev[level]
+	}
+	if next[0] != 0 && t.cmp(t.nodeKey(next[0]), kv.key) == 0 {
+		return t.update(next[0], kv, seq)
+	}
+
+	x = t.newNode(t.newEntry(kv, seq), height)
+	for i := 0; i < height; i++ {
+		for {
+			t.setNext(x, i, next[i])
+			if t.casNext(prev[i], i, next[i], x) {
+				break
+			}
+			// another node was inserted after prev, so find the new splice at this level
+			prev[i], next[i] = t.findSpliceForLevel(kv.key, prev[i], i)
+			if i == 0 && next[0] != 0 && t.cmp(t.nodeKey(next[0]), kv.key) == 0 {
+				// the same key was inserted concurrently, and x is not yet reachable
+				return t.update(next[0], kv, seq)
+			}
+		}
+	}
+	return true
+}
+
+// update replaces the entry of node if seq is greater than the seq of the current entry
+func (t *arenaMemtable) update(node uint64, kv KeyValue, seq uint64) bool {
+	if *t.word(t.entry(node)) > seq {
+		return false
+	}
+	entry := t.newEntry(kv, seq)
+	for {
+		old := t.entry(node)
+		if *t.word(old) > seq {
+			return false
+		}
+		if atomic.CompareAndSwapUint64(t.word(node), old, entry) {
+			return true
+		}
+	}
+}
+
+func (t *arenaMemtable) get(key []byte) (KeyValue, bool) {
+	x := t.findGreaterOrEqual(key)
+	if x != 0 {
+		entry := t.entry(x)
+		if t.cmp(t.entryKey(entry), key) == 0 {
+			return t.entryKeyValue(entry), true
+		}
+	}
+	return KeyValue{}, false
+}
+
+func (t *arenaMemtable) iterator() memtableIterator {
+	return &arenaIterator{t: t}
+}
+
+func (t *arenaMemtable) size() uint64 {
+	return atomic.LoadUint64(&t.used)
+}
+
+type arenaIterator struct {
+	t    *arenaMemtable
+	node uint64
+}
+
+func (i *arenaIterator) Valid() bool {
+	return i.node != 0
+}
+
+func (i *arenaIterator) Next() {
+	i.node = i.t.next(i.node, 0)
+}
+
+func (i *arenaIterator) SeekToFirst() {
+	i.node = i.t.next(0, 0)
+}
+
+func (i *arenaIterator) Seek(key KeyValue) {
+	i.node = i.t.findGreaterOrEqual(key.key)
+}
+
+func (i *arenaIterator) Key() KeyValue {
+	return i.t.entryKeyValue(i.t.entry(i.node))
+}
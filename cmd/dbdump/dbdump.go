@@ -43,7 +43,16 @@ func main() {
 		log.Fatalln("path is not a directory")
 	}
 
-	db, err := leveldb.Open(dbpath, leveldb.Options{})
+	// open the database with the options it was created with, if they were recorded
+	options, err := leveldb.LoadOptions(dbpath)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalln("unable to load database options", err)
+	}
+
+	// dumping never modifies the database, so it can be a copy on a read-only mount
+	options.ReadOnly = true
+
+	db, err := leveldb.Open(dbpath, options)
 	if err != nil {
 		log.Fatal(err)
 	}
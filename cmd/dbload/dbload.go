@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"flag"
 	"github.com/robaho/leveldb"
 	"log"
@@ -40,7 +41,7 @@ func main() {
 
 	if *remove {
 		err = leveldb.Remove(dbpath)
-		if err != leveldb.NoDatabaseFound {
+		if !errors.Is(err, leveldb.NoDatabaseFound) {
 			log.Fatal("unable to remove ")
 		}
 	}
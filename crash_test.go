@@ -0,0 +1,270 @@
+package leveldb
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+const crashPath = "test/crashdb"
+
+// crashModel records the writes acknowledged by the database, and the writes that were in progress
+// when the crash occurred, which may or may not have been applied. A removed key has an empty value.
+type crashModel struct {
+	acked   map[string]string
+	pending map[string]string
+}
+
+func newCrashModel() *crashModel {
+	return &crashModel{acked: make(map[string]string), pending: make(map[string]string)}
+}
+
+func (m *crashModel) apply(err error, kvs ...string) error {
+	for i := 0; i < len(kvs); i += 2 {
+		if err == nil {
+			m.acked[kvs[i]] = kvs[i+1]
+		} else {
+			m.pending[kvs[i]] = kvs[i+1]
+		}
+	}
+	return err
+}
+
+// crashWorkload performs puts, removes and batch writes, flushing the memory segments to disk after each round
+// if flush is true, and finally merging all segments. It returns the first error, which is caused by the crash.
+func crashWorkload(options Options, m *crashModel, rounds int, flush bool) error {
+	r := rand.New(rand.NewSource(1))
+	var db *Database
+	var err error
+	for round := 0; round < rounds; round++ {
+		if db == nil {
+			db, err = Open(crashPath, options)
+			if err != nil {
+				return err
+			}
+		}
+		for i := 0; i < 50; i++ {
+			key, value := fmt.Sprint("key", r.Intn(200)), fmt.Sprint("value", round, ".", i)
+			if err = m.apply(db.Put([]byte(key), []byte(value)), key, value); err != nil {
+				return err
+			}
+			if i%10 == 9 {
+				key = fmt.Sprint("key", r.Intn(200))
+				if _, ok := m.acked[key]; ok {
+					_, err = db.Remove([]byte(key))
+					if err = m.apply(err, key, ""); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		wb := WriteBatch{}
+		kvs := []string{}
+		for i := 0; i < 10; i++ {
+			key, value := fmt.Sprint("batch", r.Intn(20)), fmt.Sprint("batchvalue", round, ".", i)
+			wb.Put([]byte(key), []byte(value))
+			kvs = append(kvs, key, value)
+		}
+		if err = m.apply(db.Write(wb), kvs...); err != nil {
+			return err
+		}
+		if flush {
+			err = db.CloseWithMerge(0)
+			db = nil
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if db == nil {
+		db, err = Open(crashPath, options)
+		if err != nil {
+			return err
+		}
+	}
+	if flush {
+		return db.CloseWithMerge(1)
+	}
+	return nil
+}
+
+// verifyCrashModel checks that every acknowledged write is present in the database
+func verifyCrashModel(options Options, m *crashModel) error {
+	db, err := Open(crashPath, options)
+	if err != nil {
+		return fmt.Errorf("unable to open database after crash: %w", err)
+	}
+	keys := make(map[string]bool)
+	for k := range m.acked {
+		keys[k] = true
+	}
+	for k := range m.pending {
+		keys[k] = true
+	}
+	for k := range keys {
+		value, err := db.Get([]byte(k))
+		if err != nil && err != KeyNotFound {
+			return err
+		}
+		acked, ok := m.acked[k]
+		if string(value) == acked && (ok || value == nil) {
+			continue
+		}
+		if pending, ok := m.pending[k]; ok && string(value) == pending {
+			continue
+		}
+		return fmt.Errorf("key %s has value '%s', acknowledged value is '%s'", k, value, acked)
+	}
+	return db.CloseWithMerge(0)
+}
+
+// testCrashRecovery runs the workload crashing at every stride'th operation
+func testCrashRecovery(t *testing.T, rounds int, flush bool, powerLoss bool, stride int) {
+	options := Options{CreateIfNeeded: true, DisableAutoMerge: true, EnableSyncWrite: true}
+
+	ffs := newFaultFileSystem()
+	options.FileSystem = ffs
+	err := crashWorkload(options, newCrashModel(), rounds, flush)
+	if err != nil {
+		t.Fatal("workload failed without a crash", err)
+	}
+	total := ffs.operations()
+
+	for crashAt := 1; crashAt <= total; crashAt += stride {
+		ffs := newFaultFileSystem()
+		ffs.crashAt = crashAt
+		options.FileSystem = ffs
+		m := newCrashModel()
+		err := crashWorkload(options, m, rounds, flush)
+		if err != nil && !ffs.crashed {
+			t.Fatal("unexpected workload error at operation", crashAt, err)
+		}
+		options.FileSystem = ffs.crash(powerLoss)
+		// verify twice to ensure that recovery itself is durable
+		for i := 0; i < 2; i++ {
+			if err = verifyCrashModel(options, m); err != nil {
+				t.Fatal("crash at operation", crashAt, "of", total, err)
+			}
+		}
+	}
+}
+
+func TestCrashRecovery_Kill(t *testing.T) {
+	testCrashRecovery(t, 4, true, false, 1)
+}
+
+func TestCrashRecovery_PowerLossWrites(t *testing.T) {
+	testCrashRecovery(t, 4, false, true, 1)
+}
+
+func TestCrashRecovery_PowerLoss(t *testing.T) {
+	testCrashRecovery(t, 4, true, true, 1)
+}
+
+func TestFaultInjection_FailedFlush(t *testing.T) {
+	testFailedFlush(t, func(op, name string) bool {
+		return op == "create" && strings.HasSuffix(name, ".tmp")
+	})
+}
+
+func TestFaultInjection_FailedRename(t *testing.T) {
+	testFailedFlush(t, func(op, name string) bool {
+		return op == "rename" && strings.Contains(name, "data.")
+	})
+}
+
+func TestFaultInjection_FailedSync(t *testing.T) {
+	testFailedFlush(t, func(op, name string) bool {
+		return op == "syncdir"
+	})
+}
+
+// testFailedFlush verifies that a flush fails if fail returns true for an operation, and that no data is lost
+func testFailedFlush(t *testing.T, fail func(op, name string) bool) {
+	ffs := newFaultFileSystem()
+	options := Options{CreateIfNeeded: true, DisableAutoMerge: true, FileSystem: ffs}
+
+	db, err := Open(crashPath, options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	err = db.Put([]byte("mykey"), []byte("myvalue"))
+	if err != nil {
+		t.Fatal("unable to put key/value", err)
+	}
+	ffs.fail = func(op, name string) error {
+		if fail(op, name) {
+			return errors.New("injected failure")
+		}
+		return nil
+	}
+	err = db.CloseWithMerge(0)
+	if err == nil {
+		t.Fatal("close should have failed")
+	}
+	ffs.fail = nil
+
+	db, err = Open(crashPath, options)
+	if err != nil {
+		t.Fatal("unable to open database", err)
+	}
+	value, err := db.Get([]byte("mykey"))
+	if err != nil || string(value) != "myvalue" {
+		t.Fatal("value was lost", string(value), err)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+}
+
+func TestCrashRecovery_WriteOptions(t *testing.T) {
+	for _, powerLoss := range []bool{false, true} {
+		ffs := newFaultFileSystem()
+		options := Options{CreateIfNeeded: true, DisableAutoMerge: true, FileSystem: ffs}
+
+		db, err := Open(crashPath, options)
+		if err != nil {
+			t.Fatal("unable to create database", err)
+		}
+		err = db.PutWithOptions([]byte("cache"), []byte("cachevalue"), WriteOptions{Sync: true, DisableWAL: true})
+		if err != InvalidWriteOptions {
+			t.Fatal("sync without the log should fail", err)
+		}
+		err = db.PutWithOptions([]byte("cache"), []byte("cachevalue"), WriteOptions{DisableWAL: true})
+		if err != nil {
+			t.Fatal("unable to put key/value", err)
+		}
+		wb := WriteBatch{}
+		wb.Put([]byte("ledger1"), []byte("ledgervalue1"))
+		wb.Put([]byte("ledger2"), []byte("ledgervalue2"))
+		err = db.WriteWithOptions(wb, WriteOptions{Sync: true})
+		if err != nil {
+			t.Fatal("unable to write batch", err)
+		}
+		value, err := db.Get([]byte("cache"))
+		if err != nil || string(value) != "cachevalue" {
+			t.Fatal("unlogged value should be readable", string(value), err)
+		}
+
+		options.FileSystem = ffs.crash(powerLoss)
+		db, err = Open(crashPath, options)
+		if err != nil {
+			t.Fatal("unable to open database", err)
+		}
+		value, err = db.Get([]byte("ledger2"))
+		if err != nil || string(value) != "ledgervalue2" {
+			t.Fatal("synced value was lost", powerLoss, string(value), err)
+		}
+		_, err = db.Get([]byte("cache"))
+		if err != KeyNotFound {
+			t.Fatal("unlogged value should be lost", powerLoss, err)
+		}
+		err = db.Close()
+		if err != nil {
+			t.Fatal("unable to close database", err)
+		}
+	}
+}
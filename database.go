@@ -2,19 +2,22 @@ package leveldb
 
 import (
 	"bytes"
-	"io/ioutil"
-	"os"
+	"errors"
+	"io"
+	"log/slog"
 	"path/filepath"
 	"regexp"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
-
-	"github.com/nightlyone/lockfile"
 )
 
 const dbMemorySegment = 1024 * 1024
+const dbMinMemorySegment = 64 * 1024
 const dbMaxSegments = 8
+const dbMaxImmutableMemtables = 4
+const dbMergeThrottle = 100 * time.Millisecond
 
 type dbState struct {
 	segments []segment
@@ -22,10 +25,6 @@ type dbState struct {
 	multi    segment
 }
 
-type Statistics struct {
-	NumberOfSegments int
-}
-
 // Database reference is obtained via Open()
 type Database struct {
 	sync.Mutex
@@ -33,20 +32,44 @@ type Database struct {
 	// atomically updated flag to control database closing
 	closing int32
 	merger  chan bool
+	flusher chan bool
+	// bytes of the memory segment charged to the WriteBufferManager, atomically updated
+	wbmBytes uint64
+	// atomically updated flag set when the immutable segments should be written to disk, see requestFlush
+	flushRequested int32
+	// signalled when a segment has been flushed to disk, or the flusher has failed
+	flushed *sync.Cond
 	// atomically updated flag to control merger
-	inMerge   int32
+	inMerge int32
+	// held while the flusher or Resume() writes the immutable segments to disk
+	flushMu   sync.Mutex
 	deleter   Deleter
 	path      string
 	wg        sync.WaitGroup
 	nextSegID uint64
-	lockfile  lockfile.Lockfile
-	options   Options
+	lockfile  io.Closer
+	// atomic CAS so that the options can be changed while open, db.options is read-only
+	options *Options
 	// atomic CAS to avoid contention, db.state is read-only
 	state     *dbState
 	snapshots []*Snapshot
 
-	// if non-nil an asynchronous error has occurred, and the database cannot be used. must be atomically updated
-	err error
+	// queue of writers waiting for a group commit, see commit()
+	writersMu sync.Mutex
+	writers   []*writer
+	// sequence of the last logged writer, protected by the Mutex
+	seq uint64
+
+	stats statistics
+
+	// true for a read-only instance that reads the files of a primary in another process, see OpenSecondary
+	secondary bool
+
+	// if non-nil an asynchronous error has occurred, and the database cannot be written until Resume().
+	// protected by the Mutex, failed is atomically updated so that writers can check it without the lock
+	err     error
+	errTime time.Time
+	failed  int32
 }
 
 type KeyComparison func([]byte, []byte) int
@@ -59,6 +82,23 @@ const (
 	ReturnOpenError batchReadMode = 2
 )
 
+type memtableType int
+
+const (
+	// A skip list of heap allocated nodes
+	SkipListMemtable memtableType = 0
+	// A skip list that stores the keys, values and links in large blocks, which reduces the garbage collection
+	// overhead of a large MaxMemoryBytes
+	ArenaMemtable memtableType = 1
+	// An unsorted vector that is sorted when iterated, which is the fastest for bulk loading. It is only suitable
+	// for bulk loading, since each Get scans the entries written since the last iteration, and each iteration after
+	// a write sorts the table.
+	VectorMemtable memtableType = 2
+	// Skip lists partitioned by the hash of the key, which is faster for point lookups, but slower for iteration.
+	// Keys that compare equal using UserKeyCompare must be identical.
+	HashSkipListMemtable memtableType = 3
+)
+
 type Options struct {
 	// If true, then if the database does not exist on Open() it will be created.
 	CreateIfNeeded bool
@@ -67,19 +107,75 @@ type Options struct {
 	DisableAutoMerge bool
 	// Maximum number of segments per database which controls the number of open files.
 	// If the number of segments exceeds 2x this value, producers are paused while the
-	// segments are merged.
+	// segments are merged. Defaults to 8.
 	MaxSegments uint
-	// Maximum size of memory segment in bytes. Maximum memory usage per database is
-	// roughly MaxSegments * MaxMemoryBytes but can be higher based on producer rate.
+	// Maximum size of memory segment in bytes, at least 64KB. Maximum memory usage per database is
+	// roughly (MaxImmutableMemtables + 1) * MaxMemoryBytes. Defaults to 1MB.
 	MaxMemoryBytes uint64
+	// Maximum number of full memory segments and replayed log segments waiting to be written to disk by the
+	// background flusher. If exceeded, producers are paused until a segment has been written. Defaults to 4.
+	MaxImmutableMemtables int
+	// If not nil, limits the total memory used by the memory segments of all databases that share the manager.
+	WriteBufferManager *WriteBufferManager
+	// If not nil, receives notifications of flushes, merges, write stalls and background errors.
+	EventListener EventListener
+	// If not nil, receives structured log records of recovery during Open(), flushes, merges, deletions, write
+	// stalls and background errors. Use slog.New() to log to a slog.Handler.
+	Logger *slog.Logger
 	// Disable flush to disk when writing to increase performance.
 	DisableWriteFlush bool
 	// Force sync to disk when writing. If true, then DisableWriteFlush is ignored.
 	EnableSyncWrite bool
+	// Disable syncing the segment files and the database directory when memory segments are flushed and
+	// segments are merged. This is faster, but acknowledged data may be lost if the system crashes.
+	DisableSegmentSync bool
+	// The implementation of the in-memory tables of the memory segments and replayed log segments. VectorMemtable
+	// should only be used for bulk loading.
+	MemtableType memtableType
+	// The delay between the merges of the background merger, which limits the disk bandwidth used by merging.
+	// Defaults to 100ms.
+	MergeThrottle time.Duration
 	// Determines handling of partial batches during Open()
 	BatchReadMode batchReadMode
 	// Key comparison function or nil to use standard bytes.Compare
 	UserKeyCompare KeyComparison
+	// Name of the UserKeyCompare function, which is recorded in the OPTIONS file when the database is created,
+	// and must match when the database is reopened. It is required if UserKeyCompare is set, unless the database
+	// was created by an earlier version without an OPTIONS file.
+	UserKeyCompareName string
+	// FileSystem used for all file access, or nil to use the os package with memory mapped segment files
+	FileSystem FileSystem
+	// If true, the database is held entirely in memory and never touches the disk. The path is only used as
+	// a name, FileSystem is ignored, the database is always created, and all data is discarded on Close().
+	InMemory bool
+	// If true, the database is opened without taking the lock and without modifying any files, so that a copy
+	// or a database on a read-only mount can be inspected. The disk segments and the logs are read, writes fail
+	// with DatabaseReadOnly, and the database is never created. The database must not be modified by another
+	// process while it is open, use OpenSecondary to read a database that is open by another process.
+	ReadOnly bool
+}
+
+// WriteOptions control the durability of a single write, overriding the database Options.
+type WriteOptions struct {
+	// Sync the log to disk before the write returns.
+	Sync bool
+	// Do not write the entries to the log. The write is lost if the process exits before the memory segment is
+	// written to disk. Sync cannot be used when the log is disabled.
+	DisableWAL bool
+}
+
+// ReadOptions control a single read.
+type ReadOptions struct {
+	// If not nil, the read uses the snapshot rather than the current state of the database.
+	Snapshot *Snapshot
+}
+
+// fs returns the configured FileSystem or the default
+func (options Options) fs() FileSystem {
+	if options.FileSystem == nil {
+		return defaultFileSystem
+	}
+	return options.FileSystem
 }
 
 // LookupIterator iterator interface for table scanning. all iterators should be read until completion
@@ -88,15 +184,32 @@ type LookupIterator interface {
 	Next() (key []byte, value []byte, err error)
 	// returns the next non-deleted key in the index
 	peekKey() ([]byte, error)
+	// returns the length of the value for the key last returned by Next
+	valueSize() int
+}
+
+// KeyIterator iterator interface for table scanning when only the keys are needed. The values are not read
+// from disk. all iterators should be read until completion
+type KeyIterator interface {
+	// Next returns EndOfIterator when complete, if err is nil, then key is valid
+	Next() (key []byte, err error)
+	// ValueSize returns the length of the value for the key last returned by Next
+	ValueSize() int
 }
 
 type emptyIterator struct{}
 
 func (i *emptyIterator) Next() (key []byte, value []byte, err error) { return nil, nil, EndOfIterator }
 func (i *emptyIterator) peekKey() ([]byte, error)                    { return nil, EndOfIterator }
+func (i *emptyIterator) valueSize() int                              { return 0 }
 
 var global_lock sync.RWMutex
 
+// noLock is the lockfile of a read-only database, which does not take the lock
+type noLock struct{}
+
+func (noLock) Close() error { return nil }
+
 // Open a database. The database can only be opened by a single process, but the *Database
 // reference can be shared across Go routines. The path is a directory name.
 // if createIfNeeded is true, them if the db doesn't exist it will be created.
@@ -104,47 +217,75 @@ func Open(path string, options Options) (*Database, error) {
 	global_lock.Lock()
 	defer global_lock.Unlock()
 
-	db, err := open(path, options)
-	if err == NoDatabaseFound && options.CreateIfNeeded == true {
+	if options.InMemory {
+		options.FileSystem = NewMemFileSystem()
+		options.CreateIfNeeded = true
+	}
+
+	db, err := open(path, options, false)
+	if errors.Is(err, NoDatabaseFound) && options.CreateIfNeeded == true && !options.ReadOnly {
 		return create(path, options)
 	}
 	return db, err
 }
 
-func open(path string, options Options) (*Database, error) {
+func open(path string, options Options, secondary bool) (*Database, error) {
 
 	path = filepath.Clean(path)
 
-	err := IsValidDatabase(path)
+	err := validateOptions(&options)
 	if err != nil {
 		return nil, err
 	}
 
-	abs, err := filepath.Abs(path + "/lockfile")
+	err = isValidDatabase(options.fs(), path)
 	if err != nil {
 		return nil, err
 	}
-	lf, err := lockfile.New(abs)
-	if err != nil {
-		return nil, err
+
+	var lf io.Closer = noLock{}
+	if !options.ReadOnly {
+		lf, err = options.fs().Lock(filepath.Join(path, "lockfile"))
+		if err != nil {
+			return nil, &Error{Code: DatabaseInUseCode, Path: path, Err: err}
+		}
+	}
+
+	err = checkOptionsFile(options.fs(), path, &options)
+	if err == nil && !options.ReadOnly && hasOptionsFile(options.fs(), path) {
+		err = writeOptionsFile(options.fs(), path, &options)
 	}
-	err = lf.TryLock()
 	if err != nil {
-		return nil, DatabaseInUse
+		lf.Close()
+		return nil, err
 	}
 
-	db := &Database{path: path, open: true, options: options}
+	db := &Database{path: path, open: true, secondary: secondary}
+	db.setOptions(&options)
 	db.lockfile = lf
 
-	db.deleter = newDeleter(path)
+	if options.ReadOnly {
+		// the files scheduled for deletion belong to segments that are contained in a merged segment, so they
+		// are ignored by loadDiskSegments
+		db.deleter = newNullDeleter()
+	} else {
+		db.deleter = newDeleter(options.fs(), path, db.segmentDeleted)
+	}
 
 	err = db.deleter.deleteScheduled()
 	if err != nil {
+		lf.Close()
 		return nil, err
 	}
 
-	segments, err := loadDiskSegments(path, db.options)
+	var segments []segment
+	if secondary {
+		segments, err = loadPrimarySegments(path, options, nil)
+	} else {
+		segments, err = loadDiskSegments(path, options)
+	}
 	if err != nil {
+		lf.Close()
 		return nil, err
 	}
 
@@ -156,7 +297,7 @@ func open(path string, options Options) (*Database, error) {
 	}
 	atomic.StoreUint64(&db.nextSegID, uint64(maxSegID))
 
-	memory := newMemorySegment(db.path, db.nextSegmentID(), db.options)
+	memory := db.newMemorySegment()
 	multi := newMultiSegment(copyAndAppend(segments, memory))
 
 	state := &dbState{segments: segments, memory: memory, multi: multi}
@@ -164,31 +305,55 @@ func open(path string, options Options) (*Database, error) {
 	db.setState(state)
 
 	db.merger = make(chan bool)
+	db.flusher = make(chan bool, 1)
+	db.flushed = sync.NewCond(&db.Mutex)
 
-	if db.options.MaxMemoryBytes < dbMemorySegment {
-		db.options.MaxMemoryBytes = dbMemorySegment
+	if options.ReadOnly {
+		db.logger().Info("opened database read only", "segments", len(segments))
+		return db, nil
 	}
-	if db.options.MaxSegments < dbMaxSegments {
-		db.options.MaxSegments = dbMaxSegments
+
+	if options.WriteBufferManager != nil {
+		options.WriteBufferManager.register(db)
 	}
 
-	if !options.DisableAutoMerge {
-		db.wg.Add(1)
-		go mergeSegments(db)
+	db.wg.Add(1)
+	go flushSegments(db)
+	if unflushedSegments(segments) > 0 {
+		// write the log segments of the previous run to disk
+		requestFlush(db)
 	}
 
+	// the merger runs even if DisableAutoMerge is set, since it can be enabled with SetOptions
+	db.wg.Add(1)
+	go mergeSegments(db)
+
+	db.logger().Info("opened database", "segments", len(segments), "unflushed", unflushedSegments(segments))
+
 	return db, nil
 }
 
 func create(path string, options Options) (*Database, error) {
 	path = filepath.Clean(path)
 
-	err := os.MkdirAll(path, os.ModePerm)
+	err := validateOptions(&options)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = compareName(&options); err != nil {
+		return nil, err
+	}
+	err = options.fs().MkdirAll(path)
+	if err != nil {
+		return nil, err
+	}
+	// the OPTIONS file is only written for a new database, see hasOptionsFile
+	err = writeOptionsFile(options.fs(), path, &options)
 	if err != nil {
 		return nil, err
 	}
 
-	return open(path, options)
+	return open(path, options, false)
 }
 
 // Remove the database, deleting all files. the caller must be able to
@@ -197,57 +362,71 @@ func Remove(path string) error {
 	global_lock.Lock()
 	defer global_lock.Unlock()
 
+	return remove(defaultFileSystem, path)
+}
+
+// RemoveWithOptions is the same as Remove but uses the FileSystem from options
+func RemoveWithOptions(path string, options Options) error {
+	global_lock.Lock()
+	defer global_lock.Unlock()
+
+	return remove(options.fs(), path)
+}
+
+func remove(fs FileSystem, path string) error {
 	path = filepath.Clean(path)
 
-	err := IsValidDatabase(path)
+	err := isValidDatabase(fs, path)
 	if err != nil {
 		return err
 	}
 
-	abs, err := filepath.Abs(path + "/lockfile")
+	lock, err := fs.Lock(filepath.Join(path, "lockfile"))
 	if err != nil {
-		return err
-	}
-	lf, err := lockfile.New(abs)
-	if err != nil {
-		return err
-	}
-	err = lf.TryLock()
-	if err != nil {
-		return DatabaseInUse
+		return &Error{Code: DatabaseInUseCode, Path: path, Err: err}
 	}
 
-	return os.RemoveAll(path)
+	err = fs.RemoveAll(path)
+	// the lockfile has been removed, so ignore any error
+	lock.Close()
+	return err
 }
 
 // IsValidDatabase checks if the path points to a valid database or empty directory (which is also valid)
 func IsValidDatabase(path string) error {
-	fi, err := os.Stat(path)
+	return isValidDatabase(defaultFileSystem, path)
+}
+
+func isValidDatabase(fs FileSystem, path string) error {
+	fi, err := fs.Stat(path)
 	if err != nil {
-		return NoDatabaseFound
+		return &Error{Code: NoDatabaseFoundCode, Path: path, Err: err}
 	}
 
 	if !fi.IsDir() {
-		return NotADirectory
+		return &Error{Code: NotADirectoryCode, Path: path}
 	}
 
-	infos, err := ioutil.ReadDir(path)
+	names, err := fs.List(path)
 	if err != nil {
 		return err
 	}
 
-	for _, f := range infos {
-		if "lockfile" == f.Name() {
+	for _, name := range names {
+		if "lockfile" == name {
+			continue
+		}
+		if "deleted" == name {
 			continue
 		}
-		if "deleted" == f.Name() {
+		if optionsFileName == name || optionsFileName+".tmp" == name {
 			continue
 		}
-		if f.Name() == filepath.Base(path) {
+		if name == filepath.Base(path) {
 			continue
 		}
-		if matched, _ := regexp.Match("(log|keys|data)\\..*", []byte(f.Name())); !matched {
-			return NotValidDatabase
+		if matched, _ := regexp.Match("(log|keys|data)\\..*", []byte(name)); !matched {
+			return &InvalidFileError{File: filepath.Join(path, name), Err: errors.New("unexpected file")}
 		}
 	}
 	return nil
@@ -256,7 +435,7 @@ func IsValidDatabase(path string) error {
 // Close the database. any memory segments are persisted to disk.
 // The resulting segments are merged until the default maxSegments is reached
 func (db *Database) Close() error {
-	return db.CloseWithMerge(db.options.MaxSegments)
+	return db.CloseWithMerge(db.getOptions().MaxSegments)
 }
 
 // CloseWithMerge closes the database with control of the segment count. if segmentCount is 0, then
@@ -267,7 +446,18 @@ func (db *Database) CloseWithMerge(segmentCount uint) error {
 	if !db.open {
 		return DatabaseClosed
 	}
+
+	atomic.StoreInt32(&db.closing, 1)
+	close(db.merger)
+	wakeupFlusher(db)
+
+	db.wg.Wait() // wait for background merger and flusher to exit
+
+	// release any producers waiting for the flusher
+	db.Lock()
+	db.flushed.Broadcast()
 	err := db.err
+	db.Unlock()
 
 	var state *dbState
 
@@ -275,16 +465,61 @@ func (db *Database) CloseWithMerge(segmentCount uint) error {
 		goto finish
 	}
 
-	atomic.StoreInt32(&db.closing, 1)
-	close(db.merger)
+	if db.getOptions().ReadOnly {
+		// nothing to persist, and the files must not be modified
+		db.Lock()
+		for _, s := range db.snapshots {
+			s.Close()
+		}
+		db.snapshots = nil
+		db.Unlock()
+		closeSegments(db.state.segments)
+		goto finish
+	}
 
-	db.wg.Wait() // wait for background merger to exit
+	if db.getOptions().InMemory {
+		// nothing to persist
+		db.Lock()
+		for _, s := range db.snapshots {
+			s.Close()
+		}
+		db.snapshots = nil
+		db.Unlock()
+		for _, s := range db.state.segments {
+			s.Close()
+		}
+		err = db.getOptions().fs().RemoveAll(db.path)
+		goto finish
+	}
+
+	db.Lock()
+	for _, s := range db.snapshots {
+		s.Close()
+	}
+	db.snapshots = nil
+	db.Unlock()
 
+	// write the memory segment and any remaining memory and log segments to disk, so they are included in the
+	// merge, and the logs are not replayed on open
+	db.state.memory.waitForWriters()
 	state = &dbState{
 		segments: copyAndAppend(db.state.segments, db.state.memory),
 		memory:   nil,
 		multi:    nil,
 	}
+	for run := nextSegmentsToFlush(state.segments); run != nil; run = nextSegmentsToFlush(state.segments) {
+		ds, err0 := writeSegmentToDisk(db, run)
+		if err0 != nil {
+			db.err = err0
+			break
+		}
+		state.segments = replaceSegments(state.segments, run, ds)
+	}
+
+	if db.err != nil {
+		err = db.err
+		goto finish
+	}
 
 	db.state = state
 
@@ -293,31 +528,10 @@ func (db *Database) CloseWithMerge(segmentCount uint) error {
 	}
 
 	if db.err != nil {
+		err = db.err
 		goto finish
 	}
 
-	// write any remaining memory segments to disk
-	db.Lock()
-	for _, s := range db.snapshots {
-		s.Close()
-	}
-	db.snapshots = nil
-	for _, s := range db.state.segments {
-		ms, ok := s.(*memorySegment)
-		if ok {
-			db.wg.Add(1)
-			go func(s *memorySegment) {
-				err0 := writeSegmentToDisk(db, s)
-				if err0 != nil {
-					db.err = err0
-				}
-				db.wg.Done()
-			}(ms)
-		}
-	}
-
-	db.wg.Wait()
-
 	for _, s := range db.state.segments {
 		s.Close()
 	}
@@ -325,13 +539,36 @@ func (db *Database) CloseWithMerge(segmentCount uint) error {
 	err = db.deleter.deleteScheduled()
 
 finish:
+	if db.getOptions().WriteBufferManager != nil && !db.getOptions().ReadOnly {
+		db.getOptions().WriteBufferManager.unregister(db)
+	}
 	db.state = &dbState{segments: []segment{}}
-	db.lockfile.Unlock()
+	db.lockfile.Close()
 	db.open = false
 
+	if err != nil {
+		db.logger().Error("close failed", "error", err)
+	} else {
+		db.logger().Info("closed database")
+	}
 	return err
 }
 
+// newMemorySegment creates the next memory segment. The memory segments of an in memory or read-only database do not
+// have a log file.
+func (db *Database) newMemorySegment() *memorySegment {
+	options := *db.getOptions()
+	if options.InMemory || options.ReadOnly {
+		return newMemorySegment("", db.nextSegmentID(), options)
+	}
+	return newMemorySegment(db.path, db.nextSegmentID(), options)
+}
+
+// Path returns the path of the database
+func (db *Database) Path() string {
+	return db.path
+}
+
 func (db *Database) nextSegmentID() uint64 {
 	return atomic.AddUint64(&db.nextSegID, 1)
 }
@@ -342,11 +579,11 @@ func (db *Database) getState() *dbState {
 func (db *Database) setState(state *dbState) {
 	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&db.state)), unsafe.Pointer(state))
 }
-
-func (db *Database) Stats() Statistics {
-	db.Lock()
-	defer db.Unlock()
-	return Statistics{NumberOfSegments: len(db.getState().segments)}
+func (db *Database) getOptions() *Options {
+	return (*Options)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&db.options))))
+}
+func (db *Database) setOptions(options *Options) {
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&db.options)), unsafe.Pointer(options))
 }
 
 func less(a []byte, b []byte) bool {
@@ -355,6 +592,14 @@ func less(a []byte, b []byte) bool {
 func equal(a []byte, b []byte) bool {
 	return bytes.Equal(a, b)
 }
+
+// closeSegments closes the segments that were loaded when Open() fails
+func closeSegments(segments []segment) {
+	for _, s := range segments {
+		s.Close()
+	}
+}
+
 func copyAndAppend(seg []segment, segs ...segment) []segment {
 	newSlice := make([]segment, len(seg), len(seg)+len(segs))
 	copy(newSlice, seg)
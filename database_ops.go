@@ -2,6 +2,8 @@ package leveldb
 
 import (
 	"runtime"
+	"sync/atomic"
+	"time"
 )
 
 // Special iterator to skip removed records.
@@ -23,8 +25,34 @@ func (dl *dbLookup) Next() (key, value []byte, err error) {
 	}
 }
 
+// Special iterator to return only the keys of non-removed records.
+type dbKeyLookup struct {
+	itr  LookupIterator
+	size int
+}
+
+func (dkl *dbKeyLookup) Next() (key []byte, err error) {
+	for {
+		key, _, err = dkl.itr.Next()
+		if err != nil {
+			dkl.size = 0
+			return nil, err
+		}
+		dkl.size = dkl.itr.valueSize()
+		if dkl.size == 0 {
+			continue
+		}
+		return key, nil
+	}
+}
+
+func (dkl *dbKeyLookup) ValueSize() int {
+	return dkl.size
+}
+
 // Get a value for a key, error is non-nil if the key was not found or an error occurred
 func (db *Database) Get(key []byte) (value []byte, err error) {
+	defer db.stats.gets.since(time.Now())
 	if !db.open {
 		return nil, DatabaseClosed
 	}
@@ -41,48 +69,56 @@ func (db *Database) Get(key []byte) (value []byte, err error) {
 	return
 }
 
+// GetWithOptions is the same as Get, but reads from options.Snapshot if it is not nil
+func (db *Database) GetWithOptions(key []byte, options ReadOptions) (value []byte, err error) {
+	if options.Snapshot != nil {
+		return options.Snapshot.Get(key)
+	}
+	return db.Get(key)
+}
+
 // Put a key/value pair into the table, overwriting any existing entry. empty keys are not supported.
+// Concurrent calls are committed to the log as a group.
 func (db *Database) Put(key []byte, value []byte) error {
-	db.Lock()
-	defer db.maybeMerge()
-	defer db.Unlock()
+	return db.PutWithOptions(key, value, db.writeOptions())
+}
 
-	if !db.open {
-		return DatabaseClosed
-	}
+// PutWithOptions is the same as Put, but the durability of the write is determined by options rather than
+// the database Options
+func (db *Database) PutWithOptions(key []byte, value []byte, options WriteOptions) error {
+	defer db.stats.puts.since(time.Now())
 	if len(key) > 1024 {
 		return KeyTooLong
 	}
 	if len(key) == 0 {
 		return EmptyKey
 	}
-
-	db.maybeSwapMemory()
-
-	_, err := db.state.memory.Put(key, value)
-	return err
+	return db.write(&writer{entries: []KeyValue{{key: key, value: value}}, options: options})
 }
 
-// Remove a key and its value from the table. empty keys are not supported.
+// Remove a key and its value from the table, and return the previous value. empty keys are not supported.
+// The previous value is read atomically with the removal, so a concurrent Put of the key is either returned or
+// applied after the removal.
 func (db *Database) Remove(key []byte) ([]byte, error) {
-	db.Lock()
-	defer db.maybeMerge()
-	defer db.Unlock()
-
-	if !db.open {
-		return nil, DatabaseClosed
-	}
 	if len(key) > 1024 {
 		return nil, KeyTooLong
 	}
-	value, err := db.Get(key)
+	w := &writer{entries: []KeyValue{{key: key, value: emptyBytes}}, remove: true, options: db.writeOptions()}
+	err := db.write(w)
 	if err != nil {
 		return nil, err
 	}
+	return w.value, nil
+}
 
-	db.maybeSwapMemory()
-	db.state.memory.Remove(key)
-	return value, nil
+// previousValue returns the value of the key once the entries of all logged writers have been applied. It is
+// called by the leader of the writer queue, so no other writer can be logged until the leader is done.
+func (db *Database) previousValue(key []byte) ([]byte, error) {
+	if !db.open {
+		return nil, DatabaseClosed
+	}
+	db.getState().memory.waitForWriters()
+	return db.Get(key)
 }
 
 // Lookup finds matching records between lower and upper inclusive. lower or upper can be nil
@@ -90,6 +126,7 @@ func (db *Database) Remove(key []byte) ([]byte, error) {
 // are undefined and are likely to be invalid in conjunction with a large number of mutations. A Snapshot should be
 // used in this case.
 func (db *Database) Lookup(lower []byte, upper []byte) (LookupIterator, error) {
+	defer db.stats.lookups.since(time.Now())
 	s, err := db.Snapshot()
 	if err != nil {
 		return nil, err
@@ -97,6 +134,25 @@ func (db *Database) Lookup(lower []byte, upper []byte) (LookupIterator, error) {
 	return s.Lookup(lower, upper)
 }
 
+// LookupKeys finds matching keys between lower and upper inclusive, without reading the values. It has the same
+// semantics as Lookup, but removed keys are never returned.
+func (db *Database) LookupKeys(lower []byte, upper []byte) (KeyIterator, error) {
+	defer db.stats.lookups.since(time.Now())
+	s, err := db.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return s.LookupKeys(lower, upper)
+}
+
+// LookupWithOptions is the same as Lookup, but uses options.Snapshot if it is not nil
+func (db *Database) LookupWithOptions(lower []byte, upper []byte, options ReadOptions) (LookupIterator, error) {
+	if options.Snapshot != nil {
+		return options.Snapshot.Lookup(lower, upper)
+	}
+	return db.Lookup(lower, upper)
+}
+
 // Snapshot creates a read-only view of the database at a moment in time.
 func (db *Database) Snapshot() (*Snapshot, error) {
 	db.Lock()
@@ -107,10 +163,19 @@ func (db *Database) Snapshot() (*Snapshot, error) {
 	}
 
 	state := db.getState()
-	segments := copyAndAppend(state.segments, state.memory)
-	memory := newMemorySegment(db.path, db.nextSegmentID(), db.options)
-	multi := newMultiSegment(copyAndAppend(segments, memory))
-	db.setState(&dbState{segments: segments, memory: memory, multi: multi})
+	segments := state.segments
+	if !db.getOptions().ReadOnly {
+		// the memory segment of a read-only database is always empty, so it does not need to be made immutable
+		state.memory.waitForWriters()
+		segments = copyAndAppend(state.segments, state.memory)
+		memory := db.newMemorySegment()
+		multi := newMultiSegment(copyAndAppend(segments, memory))
+		db.setState(&dbState{segments: segments, memory: memory, multi: multi})
+		db.releaseWriteBuffer()
+		if unflushedSegments(segments) >= db.getOptions().MaxImmutableMemtables {
+			requestFlush(db)
+		}
+	}
 
 	s := &Snapshot{
 		db:    db,
@@ -121,36 +186,122 @@ func (db *Database) Snapshot() (*Snapshot, error) {
 	return s, nil
 }
 
+// Write the batch atomically. Concurrent calls are committed to the log as a group.
 func (db *Database) Write(wb WriteBatch) error {
+	return db.WriteWithOptions(wb, db.writeOptions())
+}
+
+// WriteWithOptions is the same as Write, but the durability of the write is determined by options rather than
+// the database Options
+func (db *Database) WriteWithOptions(wb WriteBatch, options WriteOptions) error {
+	defer db.stats.writes.since(time.Now())
+	return db.write(&writer{entries: wb.entries, batch: true, options: options})
+}
+
+// writeOptions returns the WriteOptions equivalent to the database Options
+func (db *Database) writeOptions() WriteOptions {
+	return WriteOptions{Sync: db.getOptions().EnableSyncWrite}
+}
+
+// write logs and applies the entries of the writer. Concurrent writes are committed to the log as a group, and
+// applied to the memory segment concurrently.
+func (db *Database) write(w *writer) error {
+	if w.options.Sync && w.options.DisableWAL {
+		return InvalidWriteOptions
+	}
+	if db.getOptions().ReadOnly {
+		return DatabaseReadOnly
+	}
+	if atomic.LoadInt32(&db.failed) > 0 {
+		if err := db.Err(); err != nil {
+			return db.backgroundFailure(err)
+		}
+	}
+	return db.commit(w)
+}
+
+// maybeSwapMemory makes the memory segment immutable if it is full. The caller must hold the lock.
+func (db *Database) maybeSwapMemory() error {
+	if db.getState().memory.size() <= db.getOptions().MaxMemoryBytes {
+		return nil
+	}
+	return db.swapMemory()
+}
+
+// flushMemory makes the memory segment immutable if it is not empty, so that it is written to disk by the flusher
+func (db *Database) flushMemory() error {
 	db.Lock()
-	defer db.maybeMerge()
 	defer db.Unlock()
 
-	if !db.open {
+	if !db.open || atomic.LoadInt32(&db.closing) > 0 {
 		return DatabaseClosed
 	}
+	if db.getState().memory.size() == 0 {
+		return nil
+	}
+	return db.swapMemory()
+}
 
-	db.maybeSwapMemory()
+// swapMemory makes the memory segment immutable, and wakes the flusher to write it to disk. If too many immutable
+// segments are waiting to be written, the caller is paused until the flusher catches up. The caller must hold the
+// lock.
+func (db *Database) swapMemory() error {
+	for unflushedSegments(db.getState().segments) >= db.getOptions().MaxImmutableMemtables {
+		if atomic.LoadInt32(&db.closing) > 0 || !db.open {
+			return DatabaseClosed
+		}
+		if db.err != nil {
+			return db.backgroundFailure(db.err)
+		}
+		info := WriteStallInfo{Path: db.path, ImmutableSegments: unflushedSegments(db.getState().segments)}
+		start := time.Now()
+		db.flushed.Wait()
+		info.Duration = time.Since(start)
+		atomic.AddUint64(&db.stats.stalls, 1)
+		atomic.AddInt64(&db.stats.stallTime, int64(info.Duration))
+		db.events().OnWriteStall(info)
+		db.logger().Warn("write stalled", "immutableSegments", info.ImmutableSegments, "duration", info.Duration)
+	}
+	state := db.getState()
+	state.memory.waitForWriters()
+	segments := copyAndAppend(state.segments, state.memory)
+	memory := db.newMemorySegment()
+	multi := newMultiSegment(copyAndAppend(segments, memory))
+	db.setState(&dbState{segments: segments, memory: memory, multi: multi})
+	db.releaseWriteBuffer()
+	requestFlush(db)
+	return nil
+}
 
-	return db.state.memory.Write(wb)
+// releaseWriteBuffer removes the immutable memory segment from the usage of the WriteBufferManager
+func (db *Database) releaseWriteBuffer() {
+	if wbm := db.getOptions().WriteBufferManager; wbm != nil {
+		wbm.release(db)
+	}
 }
 
-func (db *Database) maybeSwapMemory() {
+// memoryUsage returns the number of bytes used by the memory segment and the immutable segments waiting to be
+// written to disk
+func (db *Database) memoryUsage() uint64 {
 	state := db.getState()
-	if state.memory.size() > db.options.MaxMemoryBytes {
-		segments := copyAndAppend(state.segments, state.memory)
-		memory := newMemorySegment(db.path, db.nextSegmentID(), db.options)
-		multi := newMultiSegment(copyAndAppend(segments, memory))
-		db.setState(&dbState{segments: segments, memory: memory, multi: multi})
+	usage := uint64(0)
+	if state.memory != nil {
+		usage += state.memory.size()
+	}
+	for _, s := range state.segments {
+		if !isDiskSegment(s) {
+			usage += s.size()
+		}
 	}
+	return usage
 }
 
 func (db *Database) maybeMerge() {
-	if db.options.DisableAutoMerge {
+	if db.getOptions().DisableAutoMerge {
 		return
 	}
 	state := db.getState()
-	if len(state.segments) > int(2*db.options.MaxSegments) {
+	if len(state.segments) > int(2*db.getOptions().MaxSegments) {
 		wakeupMerger(db)
 	}
 }
@@ -2,9 +2,11 @@ package leveldb_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/robaho/leveldb"
 	"io/ioutil"
+	"os"
 	"strings"
 	"testing"
 )
@@ -281,3 +283,566 @@ func TestRemovedKeys(t *testing.T) {
 	}
 	err = db.CloseWithMerge(1)
 }
+
+func TestDatabaseLookupKeys(t *testing.T) {
+	leveldb.Remove("test/mydb")
+
+	db, err := leveldb.Open("test/mydb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	for i := 0; i < 100; i++ {
+		err = db.Put([]byte(fmt.Sprint("mykey", i)), []byte(fmt.Sprint("myvalue", i)))
+		if err != nil {
+			t.Fatal("unable to put key/Value", err)
+		}
+	}
+	err = db.CloseWithMerge(1)
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+
+	db, err = leveldb.Open("test/mydb", options)
+	if err != nil {
+		t.Fatal("unable to open database", err)
+	}
+	_, err = db.Remove([]byte("mykey1"))
+	if err != nil {
+		t.Fatal("unable to remove key", err)
+	}
+	err = db.Put([]byte("mykey2"), []byte("mynewvalue"))
+	if err != nil {
+		t.Fatal("unable to put key/Value", err)
+	}
+
+	itr, err := db.LookupKeys(nil, nil)
+	if err != nil {
+		t.Fatal("unable to open iterator", err)
+	}
+	count := 0
+	for {
+		key, err := itr.Next()
+		if err == leveldb.EndOfIterator {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(key) == "mykey1" {
+			t.Fatal("removed key should not be returned")
+		}
+		if string(key) == "mykey2" && itr.ValueSize() != len("mynewvalue") {
+			t.Fatal("incorrect value size", itr.ValueSize())
+		}
+		count++
+	}
+	if count != 99 {
+		t.Fatal("incorrect count, should be 99, is ", count)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+}
+
+func TestInMemory(t *testing.T) {
+	os.RemoveAll("test/memdb")
+
+	options := leveldb.Options{InMemory: true, MaxSegments: 4}
+	db, err := leveldb.Open("test/memdb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	// exceed the memory segment size to force merges
+	for i := 0; i < 100000; i++ {
+		err = db.Put([]byte(fmt.Sprint("mykey", i)), []byte(fmt.Sprint("myvalue", i)))
+		if err != nil {
+			t.Fatal("unable to put key/value", err)
+		}
+	}
+	value, err := db.Get([]byte("mykey999"))
+	if err != nil || string(value) != "myvalue999" {
+		t.Fatal("incorrect value", string(value), err)
+	}
+	if _, err := os.Stat("test/memdb"); !os.IsNotExist(err) {
+		t.Fatal("in memory database should not create files", err)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+
+	db, err = leveldb.Open("test/memdb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	_, err = db.Get([]byte("mykey999"))
+	if err != leveldb.KeyNotFound {
+		t.Fatal("in memory database should be empty after reopen", err)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+}
+
+func TestMemtableTypes(t *testing.T) {
+	types := []leveldb.Options{
+		{CreateIfNeeded: true, MemtableType: leveldb.SkipListMemtable},
+		{CreateIfNeeded: true, MemtableType: leveldb.ArenaMemtable},
+		{CreateIfNeeded: true, MemtableType: leveldb.VectorMemtable},
+		{CreateIfNeeded: true, MemtableType: leveldb.HashSkipListMemtable},
+	}
+	for _, options := range types {
+		testMemtableType(t, options)
+	}
+}
+
+func testMemtableType(t *testing.T, options leveldb.Options) {
+	leveldb.Remove("test/mydb")
+
+	db, err := leveldb.Open("test/mydb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	// exceed the memory segment size to force memory segment swaps
+	for i := 0; i < 100000; i++ {
+		err = db.Put([]byte(fmt.Sprint("mykey", i)), []byte(fmt.Sprint("myvalue", i)))
+		if err != nil {
+			t.Fatal("unable to put key/value", err)
+		}
+	}
+	_, err = db.Remove([]byte("mykey1"))
+	if err != nil {
+		t.Fatal("unable to remove key", err)
+	}
+	value, err := db.Get([]byte("mykey99999"))
+	if err != nil || string(value) != "myvalue99999" {
+		t.Fatal("incorrect value", string(value), err)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+
+	db, err = leveldb.Open("test/mydb", options)
+	if err != nil {
+		t.Fatal("unable to open database", err)
+	}
+	value, err = db.Get([]byte("mykey999"))
+	if err != nil || string(value) != "myvalue999" {
+		t.Fatal("incorrect value", string(value), err)
+	}
+	_, err = db.Get([]byte("mykey1"))
+	if err != leveldb.KeyNotFound {
+		t.Fatal("removed key should not be found", err)
+	}
+	itr, err := db.LookupKeys(nil, nil)
+	if err != nil {
+		t.Fatal("unable to lookup", err)
+	}
+	count := 0
+	for {
+		_, err = itr.Next()
+		if err != nil {
+			break
+		}
+		count++
+	}
+	if count != 99999 {
+		t.Fatal("incorrect count", options.MemtableType, count)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+}
+
+func TestOptions_Invalid(t *testing.T) {
+	leveldb.Remove("test/mydb")
+
+	_, err := leveldb.Open("test/mydb", leveldb.Options{CreateIfNeeded: true, MaxMemoryBytes: 1024})
+	if !errors.Is(err, leveldb.InvalidOptions) {
+		t.Fatal("open should fail with invalid options", err)
+	}
+	_, err = leveldb.Open("test/mydb", leveldb.Options{CreateIfNeeded: true, MemtableType: 99})
+	if !errors.Is(err, leveldb.InvalidOptions) {
+		t.Fatal("open should fail with invalid options", err)
+	}
+}
+
+func TestSetOptions(t *testing.T) {
+	leveldb.Remove("test/mydb")
+
+	db, err := leveldb.Open("test/mydb", leveldb.Options{CreateIfNeeded: true, MaxSegments: 4})
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	options := db.GetOptions()
+	if options.MaxSegments != 4 || options.MaxMemoryBytes != 1024*1024 || options.MergeThrottle == 0 {
+		t.Fatal("incorrect effective options", options)
+	}
+
+	options.MaxSegments = 16
+	options.MaxMemoryBytes = 128 * 1024
+	options.DisableAutoMerge = true
+	options.EnableSyncWrite = true
+	err = db.SetOptions(options)
+	if err != nil {
+		t.Fatal("unable to set options", err)
+	}
+	options = db.GetOptions()
+	if options.MaxSegments != 16 || options.MaxMemoryBytes != 128*1024 || !options.DisableAutoMerge || !options.EnableSyncWrite {
+		t.Fatal("options were not changed", options)
+	}
+
+	invalid := options
+	invalid.MaxMemoryBytes = 1024
+	if err = db.SetOptions(invalid); !errors.Is(err, leveldb.InvalidOptions) {
+		t.Fatal("invalid MaxMemoryBytes should fail", err)
+	}
+	invalid = options
+	invalid.MemtableType = leveldb.ArenaMemtable
+	if err = db.SetOptions(invalid); !errors.Is(err, leveldb.InvalidOptions) {
+		t.Fatal("changing MemtableType should fail", err)
+	}
+	if db.GetOptions().MaxMemoryBytes != 128*1024 {
+		t.Fatal("failed SetOptions should not change the options")
+	}
+
+	// the smaller memory segments are written to disk
+	for i := 0; i < 10000; i++ {
+		err = db.Put([]byte(fmt.Sprint("mykey", i)), []byte(fmt.Sprint("myvalue", i)))
+		if err != nil {
+			t.Fatal("unable to put key/value", err)
+		}
+	}
+	if db.Stats().NumberOfSegments < 2 {
+		t.Fatal("memory segments should have been swapped", db.Stats().NumberOfSegments)
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+	if err = db.SetOptions(options); err != leveldb.DatabaseClosed {
+		t.Fatal("SetOptions should fail on a closed database", err)
+	}
+}
+
+func TestOptionsFile(t *testing.T) {
+	leveldb.Remove("test/mydb")
+
+	reverse := func(a, b []byte) int { return bytes.Compare(b, a) }
+
+	_, err := leveldb.LoadOptions("test/mydb")
+	if !os.IsNotExist(err) {
+		t.Fatal("options should not exist", err)
+	}
+
+	db, err := leveldb.Open("test/mydb", leveldb.Options{CreateIfNeeded: true, MaxSegments: 16, UserKeyCompare: reverse, UserKeyCompareName: "reverse"})
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	err = db.Put([]byte("mykey"), []byte("myvalue"))
+	if err != nil {
+		t.Fatal("unable to put key/value", err)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+
+	options, err := leveldb.LoadOptions("test/mydb")
+	if err != nil {
+		t.Fatal("unable to load options", err)
+	}
+	if options.MaxSegments != 16 || options.UserKeyCompareName != "reverse" || options.UserKeyCompare != nil {
+		t.Fatal("incorrect options loaded", options)
+	}
+
+	_, err = leveldb.Open("test/mydb", options)
+	if !errors.Is(err, leveldb.InvalidOptions) {
+		t.Fatal("open without the key comparison should fail", err)
+	}
+	_, err = leveldb.Open("test/mydb", leveldb.Options{})
+	if !errors.Is(err, leveldb.IncompatibleOptions) {
+		t.Fatal("open with a different key comparison should fail", err)
+	}
+
+	_, err = leveldb.Open("test/mydb", leveldb.Options{UserKeyCompare: reverse})
+	if !errors.Is(err, leveldb.InvalidOptions) {
+		t.Fatal("open with an unnamed key comparison should fail", err)
+	}
+
+	options.UserKeyCompare = reverse
+	db, err = leveldb.Open("test/mydb", options)
+	if err != nil {
+		t.Fatal("unable to open database with the loaded options", err)
+	}
+	value, err := db.Get([]byte("mykey"))
+	if err != nil || string(value) != "myvalue" {
+		t.Fatal("incorrect value", string(value), err)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+
+	leveldb.Remove("test/mydb")
+	_, err = leveldb.Open("test/mydb", leveldb.Options{CreateIfNeeded: true, UserKeyCompare: reverse})
+	if !errors.Is(err, leveldb.InvalidOptions) {
+		t.Fatal("create with an unnamed key comparison should fail", err)
+	}
+}
+
+func TestOptionsFile_EarlierVersion(t *testing.T) {
+	leveldb.Remove("test/mydb")
+
+	db, err := leveldb.Open("test/mydb", leveldb.Options{CreateIfNeeded: true})
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+	// a database created by an earlier version does not have an OPTIONS file
+	err = os.Remove("test/mydb/OPTIONS")
+	if err != nil {
+		t.Fatal("unable to remove OPTIONS file", err)
+	}
+
+	reverse := func(a, b []byte) int { return bytes.Compare(b, a) }
+	db, err = leveldb.Open("test/mydb", leveldb.Options{UserKeyCompare: reverse})
+	if err != nil {
+		t.Fatal("unable to open database", err)
+	}
+	err = db.SetOptions(db.GetOptions())
+	if err != nil {
+		t.Fatal("unable to set options", err)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+	if _, err = os.Stat("test/mydb/OPTIONS"); !os.IsNotExist(err) {
+		t.Fatal("OPTIONS file should not be written to an existing database", err)
+	}
+}
+
+func TestOpen_InvalidFiles(t *testing.T) {
+	leveldb.Remove("test/mydb")
+
+	db, err := leveldb.Open("test/mydb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	err = db.Put([]byte("mykey"), []byte("myvalue"))
+	if err != nil {
+		t.Fatal("unable to put key/value", err)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+
+	// a stray file with an invalid segment name
+	err = ioutil.WriteFile("test/mydb/keys.abc", []byte("junk"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = leveldb.Open("test/mydb", options)
+	var invalidFile *leveldb.InvalidFileError
+	if !errors.Is(err, leveldb.NotValidDatabase) || !errors.As(err, &invalidFile) || !strings.HasSuffix(invalidFile.File, "keys.abc") {
+		t.Fatal("open should fail with an invalid file", err)
+	}
+	os.Remove("test/mydb/keys.abc")
+
+	// a log file with a truncated entry
+	err = ioutil.WriteFile("test/mydb/log.99", []byte{5, 0, 0, 0, 'm', 'y'}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = leveldb.Open("test/mydb", options)
+	var corruption *leveldb.CorruptionError
+	if !errors.Is(err, leveldb.DatabaseCorrupted) || !errors.As(err, &corruption) || !strings.HasSuffix(corruption.File, "log.99") || corruption.Offset != 0 {
+		t.Fatal("open should fail with a corrupted log file", err)
+	}
+	os.Remove("test/mydb/log.99")
+
+	// a key file with an invalid key length
+	files, err := ioutil.ReadDir("test/mydb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := ""
+	for _, fi := range files {
+		if strings.HasPrefix(fi.Name(), "keys.") {
+			keyFile = "test/mydb/" + fi.Name()
+		}
+	}
+	f, err := os.OpenFile(keyFile, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteAt([]byte{0xff, 0x0f}, 0)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = leveldb.Open("test/mydb", options)
+	if !errors.Is(err, leveldb.DatabaseCorrupted) || !errors.As(err, &corruption) || corruption.File != keyFile {
+		t.Fatal("open should fail with a corrupted key file", err)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	leveldb.Remove("test/mydb")
+
+	_, err := leveldb.Open("test/mydb", leveldb.Options{})
+	var e *leveldb.Error
+	if !errors.Is(err, leveldb.NoDatabaseFound) || !errors.Is(err, os.ErrNotExist) || !errors.As(err, &e) || e.Path != "test/mydb" {
+		t.Fatal("open should fail with the cause", err)
+	}
+
+	// the memory file system detects a second open in the same process
+	memOptions := leveldb.Options{CreateIfNeeded: true, FileSystem: leveldb.NewMemFileSystem()}
+	db, err := leveldb.Open("test/mydb", memOptions)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	defer db.Close()
+	_, err = leveldb.Open("test/mydb", memOptions)
+	if !errors.Is(err, leveldb.DatabaseInUse) || leveldb.CodeOf(err) != leveldb.DatabaseInUseCode {
+		t.Fatal("open should fail with database in use", err)
+	}
+
+	// round trip the error as a remote client would
+	remote := leveldb.FromCode(leveldb.CodeOf(err), err.Error())
+	if !errors.Is(remote, leveldb.DatabaseInUse) || remote.Error() != err.Error() {
+		t.Fatal("incorrect remote error", remote)
+	}
+	// earlier remote clients map the message
+	if leveldb.MapError(err.Error()) != leveldb.DatabaseInUse || leveldb.MapError(leveldb.KeyNotFound.Error()) != leveldb.KeyNotFound {
+		t.Fatal("message should map to the sentinel", leveldb.MapError(err.Error()))
+	}
+	if leveldb.MapError("other: database in use").Error() != "other: database in use" {
+		t.Fatal("unknown message should not map to a sentinel")
+	}
+	if leveldb.FromCode(leveldb.KeyNotFoundCode, leveldb.KeyNotFound.Error()) != leveldb.KeyNotFound {
+		t.Fatal("sentinel should be returned without context")
+	}
+	if leveldb.CodeOf(fmt.Errorf("wrapped: %w", leveldb.KeyTooLong)) != leveldb.KeyTooLongCode {
+		t.Fatal("incorrect code for wrapped sentinel")
+	}
+	if leveldb.CodeOf(&leveldb.CorruptionError{File: "keys.1.1"}) != leveldb.DatabaseCorruptedCode {
+		t.Fatal("incorrect code for corruption error")
+	}
+	if leveldb.CodeOf(errors.New("other")) != leveldb.UnknownCode {
+		t.Fatal("incorrect code for unknown error")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	leveldb.Remove("test/mydb")
+
+	readOnly := leveldb.Options{CreateIfNeeded: true, ReadOnly: true}
+	_, err := leveldb.Open("test/mydb", readOnly)
+	if !errors.Is(err, leveldb.NoDatabaseFound) {
+		t.Fatal("read-only open should not create the database", err)
+	}
+
+	db, err := leveldb.Open("test/mydb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	err = db.Put([]byte("mykey"), []byte("myvalue"))
+	if err != nil {
+		t.Fatal("unable to put key/value", err)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+	// the second key is only in the log
+	db, err = leveldb.Open("test/mydb", options)
+	if err != nil {
+		t.Fatal("unable to open database", err)
+	}
+	defer db.Close()
+	err = db.Put([]byte("mykey2"), []byte("myvalue2"))
+	if err != nil {
+		t.Fatal("unable to put key/value", err)
+	}
+	// an incomplete segment is ignored rather than removed
+	err = ioutil.WriteFile("test/mydb/keys.99.99.tmp", []byte("junk"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("test/mydb/keys.99.99.tmp")
+
+	listFiles := func() string {
+		files, err := ioutil.ReadDir("test/mydb")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		for _, fi := range files {
+			fmt.Fprintln(&b, fi.Name(), fi.Size(), fi.ModTime())
+		}
+		return b.String()
+	}
+	before := listFiles()
+
+	rdb, err := leveldb.Open("test/mydb", readOnly)
+	if err != nil {
+		t.Fatal("unable to open database read only", err)
+	}
+	for _, key := range []string{"mykey", "mykey2"} {
+		_, err = rdb.Get([]byte(key))
+		if err != nil {
+			t.Fatal("key should exist", key, err)
+		}
+	}
+	snapshot, err := rdb.Snapshot()
+	if err != nil {
+		t.Fatal("unable to create snapshot", err)
+	}
+	itr, err := snapshot.Lookup(nil, nil)
+	if err != nil {
+		t.Fatal("unable to lookup", err)
+	}
+	count := 0
+	for {
+		_, _, err = itr.Next()
+		if err != nil {
+			break
+		}
+		count++
+	}
+	if count != 2 {
+		t.Fatal("incorrect count", count)
+	}
+	snapshot.Close()
+
+	err = rdb.Put([]byte("mykey3"), []byte("myvalue3"))
+	if err != leveldb.DatabaseReadOnly {
+		t.Fatal("put should fail on a read-only database", err)
+	}
+	wb := leveldb.WriteBatch{}
+	wb.Put([]byte("mykey3"), []byte("myvalue3"))
+	if err = rdb.Write(wb); err != leveldb.DatabaseReadOnly {
+		t.Fatal("write should fail on a read-only database", err)
+	}
+	if _, err = rdb.Remove([]byte("mykey")); err != leveldb.DatabaseReadOnly {
+		t.Fatal("remove should fail on a read-only database", err)
+	}
+	err = rdb.Close()
+	if err != nil {
+		t.Fatal("unable to close read-only database", err)
+	}
+	if after := listFiles(); after != before {
+		t.Fatal("read-only database modified files", before, after)
+	}
+}
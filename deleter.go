@@ -3,6 +3,7 @@ package leveldb
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,8 +15,11 @@ type Deleter interface {
 }
 
 type dbDeleter struct {
+	fs   FileSystem
 	path string
-	file *os.File
+	file WritableFile
+	// called with the names of the files removed by deleteScheduled
+	removed func(files []string)
 }
 
 type nullDeleter struct {
@@ -31,9 +35,11 @@ func newNullDeleter() Deleter {
 	return &nullDeleter{}
 }
 
-func newDeleter(path string) Deleter {
+func newDeleter(fs FileSystem, path string, removed func(files []string)) Deleter {
 	return &dbDeleter{
-		path: path,
+		fs:      fs,
+		path:    path,
+		removed: removed,
 	}
 }
 
@@ -42,15 +48,17 @@ func (d *dbDeleter) scheduleDeletion(filesToDelete []string) error {
 		return nil;
 	} 
 	if d.file == nil {
-		file, err := os.OpenFile(filepath.Join(d.path, "deleted"), os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_SYNC, 0600)
+		file, err := d.fs.Append(filepath.Join(d.path, "deleted"))
 		if err != nil {
 			return err
 		}
 		d.file = file
 	}
-	//fmt.Printf("%s,%s\n", ifExists, strings.Join(filesToDelete, ","))
 	_, err := fmt.Fprintf(d.file, "%s\n", strings.Join(filesToDelete, ","))
-	return err
+	if err != nil {
+		return err
+	}
+	return d.file.Sync()
 }
 func (d *dbDeleter) deleteScheduled() error {
 	if d.file != nil {
@@ -61,35 +69,41 @@ func (d *dbDeleter) deleteScheduled() error {
 		d.file = nil
 	}
 	filename := filepath.Join(d.path, "deleted")
-	f, err := os.OpenFile(filename, os.O_RDONLY, 0)
+	f, err := d.fs.Open(filename)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
 		}
 		return err
 	}
-	s := bufio.NewScanner(f)
+	s := bufio.NewScanner(io.NewSectionReader(f, 0, int64(f.Len())))
 	for s.Scan() {
 		line := s.Text()
 		// if line=="" {
 		// 	continue;
 		// }
-		//fmt.Println("deleted:", line)
 		files := strings.Split(line, ",")
+		removed := make([]string, 0, len(files))
 		for _, file := range files {
 			path := filepath.Join(d.path, file)
-			err := os.Remove(path)
+			err := d.fs.Remove(path)
 			if err != nil && !os.IsNotExist(err) {
 				// ignore if the file has already been deleted
 				return err
 			}
+			if err == nil {
+				removed = append(removed, file)
+			}
+		}
+		if len(removed) > 0 {
+			d.removed(removed)
 		}
 	}
 	err = f.Close()
 	if err != nil {
 		return err
 	}
-	err = os.Remove(filename)
+	err = d.fs.Remove(filename)
 	if err != nil {
 		return err
 	}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync/atomic"
+	"time"
 )
 
 const keyBlockSize = 4096
@@ -18,41 +20,100 @@ const maxPrefixLen uint16 = 0xFF ^ 0x80
 const maxCompressedLen uint16 = 0xFF
 const keyIndexInterval int = 16
 
-// called to write a memory segment to disk after which the memory segment is closed, and the log file removed
-func writeSegmentToDisk(db *Database, seg *memorySegment) error {
-	itr, err := seg.Lookup(nil, nil)
+// called to write consecutive memory segments or log segments to disk as a single segment, after which the
+// segments are closed, and the log files removed. It returns the disk segment, or nil if the segments were empty.
+func writeSegmentToDisk(db *Database, segments []segment) (segment, error) {
+	empty, err := emptySegments(segments)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	if _, err = itr.peekKey(); err == EndOfIterator {
-		seg.removeSegment()
-		// simply return and re-use existing memory segment
-		return nil
+	if empty {
+		return nil, removeFlushedSegments(db, segments)
+	}
+	itr, err := newMultiSegment(segments).Lookup(nil, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	lowerId := seg.LowerID()
-	upperId := seg.LowerID()
+	lowerId := segments[0].LowerID()
+	upperId := segments[len(segments)-1].UpperID()
 
 	keyFilename := filepath.Join(db.path, fmt.Sprintf("keys.%d.%d", lowerId, upperId))
 	dataFilename := filepath.Join(db.path, fmt.Sprintf("data.%d.%d", lowerId, upperId))
 
-	_, err = writeAndLoadSegment(keyFilename, dataFilename, itr, false)
+	info := FlushInfo{Path: db.path, Segment: SegmentID{Lower: lowerId, Upper: upperId}}
+	db.events().OnFlushBegin(info)
+
+	start := time.Now()
+	ds, err := writeAndLoadSegment(*db.getOptions(), keyFilename, dataFilename, itr, false)
 	if err != nil {
-		return err
+		err = ioError(db.path, info.Segment, err)
 	}
-	seg.removeSegment()
+	info.Duration, info.Err = time.Since(start), err
+	if ds != nil {
+		info.Bytes = ds.size()
+	}
+	db.events().OnFlushEnd(info)
+	if err != nil {
+		db.logger().Error("flush failed", segmentAttr("segment", info.Segment), "error", err)
+		return nil, err
+	}
+	db.logger().Info("flushed segment", segmentAttr("segment", info.Segment), "bytes", info.Bytes, "duration", info.Duration)
+	// the segment is durable, so the log files are no longer needed
+	removeFlushedSegments(db, segments)
+
+	atomic.AddUint64(&db.stats.flushes, 1)
+	atomic.AddUint64(&db.stats.flushBytesWritten, info.Bytes)
 
-	return nil
+	return ds, nil
 }
 
-func writeAndLoadSegment(keyFilename, dataFilename string, itr LookupIterator, purgeDeleted bool) (segment, error) {
+// emptySegments returns true if none of the segments contain an entry
+func emptySegments(segments []segment) (bool, error) {
+	for _, s := range segments {
+		itr, err := s.Lookup(nil, nil)
+		if err != nil {
+			return false, err
+		}
+		_, err = itr.peekKey()
+		if err == nil {
+			return false, nil
+		}
+		if err != EndOfIterator {
+			return false, err
+		}
+	}
+	return true, nil
+}
 
-	_, err := os.Stat(keyFilename);
+// removeFlushedSegments removes the log files of the segments, and returns the first error
+func removeFlushedSegments(db *Database, segments []segment) error {
+	var err error
+	for _, s := range segments {
+		files := s.files()
+		if err0 := s.removeSegment(); err0 != nil {
+			if err == nil {
+				err = err0
+			}
+			continue
+		}
+		db.segmentDeleted(files)
+	}
+	return err
+}
+
+// writeAndLoadSegment writes the segment files using temporary names, and renames them once complete. Unless
+// Options.DisableSegmentSync is set, the files and the directory are synced before returning, so the caller can
+// safely remove the source of the segment.
+func writeAndLoadSegment(options Options, keyFilename, dataFilename string, itr LookupIterator, purgeDeleted bool) (segment, error) {
+
+	fs := options.fs()
+
+	_, err := fs.Stat(keyFilename);
 	if(err==nil || !os.IsNotExist(err)) {
 		return nil,err;
 	}
-	_, err = os.Stat(dataFilename);
+	_, err = fs.Stat(dataFilename);
 	if(err==nil || !os.IsNotExist(err)) {
 		return nil,err;
 	}
@@ -60,30 +121,44 @@ func writeAndLoadSegment(keyFilename, dataFilename string, itr LookupIterator, p
 	keyFilenameTmp := keyFilename + ".tmp"
 	dataFilenameTmp := dataFilename + ".tmp"
 
-	keyIndex, err := writeSegmentFiles(keyFilenameTmp, dataFilenameTmp, itr, purgeDeleted)
+	sync := !options.DisableSegmentSync
+
+	keyIndex, err := writeSegmentFiles(fs, keyFilenameTmp, dataFilenameTmp, itr, purgeDeleted, sync)
 	if err != nil {
-		os.Remove(keyFilenameTmp)
-		os.Remove(dataFilenameTmp)
+		fs.Remove(keyFilenameTmp)
+		fs.Remove(dataFilenameTmp)
 		return nil, err
 	}
 
-	os.Rename(keyFilenameTmp, keyFilename)
-	os.Rename(dataFilenameTmp, dataFilename)
+	err = fs.Rename(keyFilenameTmp, keyFilename)
+	if err != nil {
+		return nil, err
+	}
+	err = fs.Rename(dataFilenameTmp, dataFilename)
+	if err != nil {
+		return nil, err
+	}
+	if sync {
+		err = fs.SyncDir(filepath.Dir(keyFilename))
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	return newDiskSegment(keyFilename, dataFilename, keyIndex)
+	return newDiskSegment(fs, keyFilename, dataFilename, keyIndex)
 }
 
-func writeSegmentFiles(keyFName, dataFName string, itr LookupIterator, purgeDeleted bool) ([][]byte, error) {
+func writeSegmentFiles(fs FileSystem, keyFName, dataFName string, itr LookupIterator, purgeDeleted bool, sync bool) ([][]byte, error) {
 
 	var keyIndex [][]byte
 
-	keyF, err := os.OpenFile(keyFName, os.O_CREATE|os.O_WRONLY, os.ModePerm)
+	keyF, err := fs.Create(keyFName)
 	if err != nil {
 		return nil, err
 	}
 	defer keyF.Close()
 
-	dataF, err := os.OpenFile(dataFName, os.O_CREATE|os.O_WRONLY, os.ModePerm)
+	dataF, err := fs.Create(dataFName)
 	if err != nil {
 		return nil, err
 	}
@@ -164,8 +239,16 @@ func writeSegmentFiles(keyFName, dataFName string, itr LookupIterator, purgeDele
 		keyBlockLen = 0
 	}
 
-	keyW.Flush()
-	dataW.Flush()
+	err = errn(keyW.Flush(), dataW.Flush())
+	if err != nil {
+		return nil, err
+	}
+	if sync {
+		err = errn(keyF.Sync(), dataF.Sync())
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return keyIndex, nil
 
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -33,12 +34,13 @@ import (
 // byte array with the offset and length in the key file
 //
 // The filenames are prefix.lower.upper, where prefix is 'keys' or 'data', and lower/upper is the
-// segment identifier range contained in the file. Invalid filenames in the database will cause
-// a panic on open.
+// segment identifier range contained in the file. Invalid filenames in the database cause Open() to fail
+// with an InvalidFileError.
 type diskSegment struct {
-	keyFile   *memoryMappedFile
+	fs        FileSystem
+	keyFile   *segmentFile
 	keyBlocks int64
-	dataFile  *memoryMappedFile
+	dataFile  *segmentFile
 	lowerID   uint64
 	upperID   uint64
 	// nil for segments loaded during initial open
@@ -56,73 +58,118 @@ type diskSegmentIterator struct {
 	bufferOffset int
 	key          []byte
 	data         []byte
+	dataLen      uint32
 	isValid      bool
 	err          error
 	finished     bool
+	mode         valueMode
 }
 
+// valueMode controls how a diskSegmentIterator returns values
+type valueMode int
+
+const (
+	// values are copied from the data file
+	copyValues valueMode = iota
+	// the data file is not read and values are always emptyBytes, use valueSize() for the length
+	keysOnly
+	// values refer directly to the memory mapped data file and are only valid until the segment is closed
+	zeroCopy
+)
+
 func loadDiskSegments(directory string, options Options) ([]segment, error) {
-	files, err := os.ReadDir(directory)
+	fs := options.fs()
+	logger := options.logger().With("path", directory)
+	files, err := fs.List(directory)
 	if err != nil {
 		return nil, err
 	}
 	segments := []segment{}
+	// the segments of a read-only database with 'tmp' files, which are ignored rather than removed
+	incomplete := map[string]bool{}
 	// first remove any 'tmp' files and related non-temp files as this signifies
 	// a failure during write
 	for _, file := range files {
-		if !strings.HasSuffix(file.Name(), ".tmp") {
+		if !strings.HasSuffix(file, ".tmp") {
 			continue
 		}
-		base := strings.TrimSuffix(file.Name(), ".tmp")
+		base := strings.TrimSuffix(file, ".tmp")
 		var segs string
 		if strings.HasPrefix(base, "keys.") {
 			segs = strings.TrimPrefix(base, "keys.")
 		} else {
 			segs = strings.TrimPrefix(base, "data.")
 		}
+		if options.ReadOnly {
+			incomplete[segs] = true
+			continue
+		}
 		removeFileIfExists := func(filename string) error {
-			err := os.Remove(filename)
+			err := fs.Remove(filename)
 			if err != nil && !os.IsNotExist(err) {
 				return err
 			}
 			return nil
 		}
-		err0 := removeFileIfExists(fmt.Sprint("keys.", segs))
-		err1 := removeFileIfExists(fmt.Sprint("data.", segs))
-		err2 := removeFileIfExists(fmt.Sprint("keys.", segs, ".tmp"))
-		err3 := removeFileIfExists(fmt.Sprint("data.", segs, ".tmp"))
+		err0 := removeFileIfExists(filepath.Join(directory, fmt.Sprint("keys.", segs)))
+		err1 := removeFileIfExists(filepath.Join(directory, fmt.Sprint("data.", segs)))
+		err2 := removeFileIfExists(filepath.Join(directory, fmt.Sprint("keys.", segs, ".tmp")))
+		err3 := removeFileIfExists(filepath.Join(directory, fmt.Sprint("data.", segs, ".tmp")))
 		err = errn(err0, err1, err2, err3)
 		if err != nil {
 			return nil, err
 		}
+		logger.Info("removed incomplete segment", "file", file)
 	}
 	// re-read as temporary files should be removed
-	files, err = os.ReadDir(directory)
+	files, err = fs.List(directory)
 	if err != nil {
 		return nil, err
 	}
 
 	for _, file := range files {
-		if strings.HasPrefix(file.Name(), "log.") {
-			ls, err := newLogSegment(filepath.Join(directory, file.Name()), options)
+		if strings.HasPrefix(file, "log.") {
+			ls, err := newLogSegment(filepath.Join(directory, file), options, false)
 			if err != nil {
-				panic(fmt.Sprint("unable to load logSegment", file, err))
+				closeSegments(segments)
+				return nil, err
 			}
+			logger.Info("replayed log", "file", file, "bytes", ls.size())
 			segments = append(segments, ls)
 			continue
 		}
-		if !strings.HasPrefix(file.Name(), "keys.") {
+		if !strings.HasPrefix(file, "keys.") || strings.HasSuffix(file, ".tmp") || incomplete[strings.TrimPrefix(file, "keys.")] {
 			continue
 		}
-		lowerId, upperId := getSegmentIDs(file.Name())
+		lowerId, upperId, err := getSegmentIDs(filepath.Join(directory, file))
+		if err != nil {
+			closeSegments(segments)
+			return nil, err
+		}
 		keyFilename := filepath.Join(directory, fmt.Sprintf("keys.%d.%d", lowerId, upperId))
 		dataFilename := filepath.Join(directory, fmt.Sprintf("data.%d.%d", lowerId, upperId))
-		segment, err := newDiskSegment(keyFilename, dataFilename, nil)
+		segment, err := newDiskSegment(fs, keyFilename, dataFilename, nil)
 		if err != nil {
+			closeSegments(segments)
 			return nil, err
 		}
 		segments = append(segments, segment) // don't have keyIndex
 	}
+	// remove any segments that are fully contained in another segment
+	segments = orderSegments(segments, func(seg, containedIn segment) {
+		if options.ReadOnly {
+			seg.Close()
+			return
+		}
+		seg.removeSegment()
+		logger.Info("removed segment contained in another segment", segmentAttr("segment", segmentID(seg)), segmentAttr("containedIn", segmentID(containedIn)))
+	})
+	return segments, nil
+}
+
+// orderSegments sorts the segments from oldest to newest, and removes the segments that are fully contained in
+// another segment, calling contained for each
+func orderSegments(segments []segment, contained func(seg, containedIn segment)) []segment {
 	sort.Slice(segments, func(i, j int) bool {
 		id1, id2 := segments[i].UpperID(), segments[j].UpperID()
 		if id1 == id2 {
@@ -132,7 +179,6 @@ func loadDiskSegments(directory string, options Options) ([]segment, error) {
 		}
 		return id1 < id2
 	})
-	// remove any segments that are fully contained in another segment
 next:
 	for i := 0; i < len(segments); {
 		seg := segments[i]
@@ -140,52 +186,63 @@ next:
 			seg0 := segments[j]
 			if seg.LowerID() >= seg0.LowerID() && seg.UpperID() <= seg0.UpperID() {
 				segments = append(segments[:i], segments[i+1:]...)
-				seg.removeSegment()
+				contained(seg, seg0)
 				continue next
 			}
 		}
 		i++
 	}
-	return segments, nil
+	return segments
 }
 
-func getSegmentID(filename string) (id uint64) {
-	base := filepath.Base(filename)
-	segs := strings.Split(base, ".")
-	id0, err := strconv.Atoi(segs[1])
+func getSegmentID(filename string) (id uint64, err error) {
+	segs := strings.Split(filepath.Base(filename), ".")
+	if len(segs) != 2 {
+		return 0, &InvalidFileError{File: filename, Err: errors.New("invalid segment filename")}
+	}
+	id, err = strconv.ParseUint(segs[1], 10, 64)
 	if err != nil {
-		panic(fmt.Sprint("invalid segment filename", base))
+		return 0, &InvalidFileError{File: filename, Err: err}
 	}
-	return uint64(id0)
+	return id, nil
 }
 
-func getSegmentIDs(filename string) (lower, upper uint64) {
-	base := filepath.Base(filename)
-	segs := strings.Split(base, ".")
-	id0, err := strconv.Atoi(segs[1])
-	if err != nil {
-		panic(fmt.Sprint("invalid segment filename", base))
+func getSegmentIDs(filename string) (lower, upper uint64, err error) {
+	segs := strings.Split(filepath.Base(filename), ".")
+	if len(segs) != 3 {
+		return 0, 0, &InvalidFileError{File: filename, Err: errors.New("invalid segment filename")}
+	}
+	lower, err = strconv.ParseUint(segs[1], 10, 64)
+	if err == nil {
+		upper, err = strconv.ParseUint(segs[2], 10, 64)
 	}
-	id1, err := strconv.Atoi(segs[2])
 	if err != nil {
-		panic(fmt.Sprint("invalid segment filename", base))
+		return 0, 0, &InvalidFileError{File: filename, Err: err}
 	}
-	return uint64(id0), uint64(id1)
+	if lower > upper {
+		return 0, 0, &InvalidFileError{File: filename, Err: errors.New("invalid segment id range")}
+	}
+	return lower, upper, nil
 }
 
-func newDiskSegment(keyFilename, dataFilename string, keyIndex [][]byte) (segment, error) {
+func newDiskSegment(fs FileSystem, keyFilename, dataFilename string, keyIndex [][]byte) (segment, error) {
 
-	lower, upper := getSegmentIDs(keyFilename)
+	lower, upper, err := getSegmentIDs(keyFilename)
+	if err != nil {
+		return nil, err
+	}
 
 	ds := &diskSegment{}
-	kf, err := newMemoryMappedFile(keyFilename)
+	kf, err := newSegmentFile(fs, keyFilename)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	df, err := newMemoryMappedFile(dataFilename)
+	df, err := newSegmentFile(fs, dataFilename)
 	if err != nil {
-		panic(err)
+		kf.Close()
+		return nil, err
 	}
+	ds.fs = fs
 	ds.keyFile = kf
 	ds.dataFile = df
 	ds.lowerID = lower
@@ -193,21 +250,22 @@ func newDiskSegment(keyFilename, dataFilename string, keyIndex [][]byte) (segmen
 
 	ds.keyBlocks = (kf.Length()-1)/keyBlockSize + 1
 
+	if kf.Length()%keyBlockSize != 0 {
+		ds.Close()
+		return nil, corruption(keyFilename, kf.Length(), errors.New("key file is not a multiple of the block size"))
+	}
+
 	if keyIndex == nil {
 		// TODO maybe load this in the background
-		keyIndex = loadKeyIndex(kf, ds.keyBlocks)
+		keyIndex, err = loadKeyIndex(kf, ds.keyBlocks)
+		if err != nil {
+			ds.Close()
+			return nil, err
+		}
 	}
 
 	ds.keyIndex = keyIndex
-	kInfo, err := os.Stat(keyFilename)
-	if err != nil {
-		return nil, err
-	}
-	dInfo, err := os.Stat(dataFilename)
-	if err != nil {
-		return nil, err
-	}
-	ds.filesize = uint64(kInfo.Size() + dInfo.Size())
+	ds.filesize = uint64(kf.Length() + df.Length())
 	return ds, nil
 }
 
@@ -215,30 +273,33 @@ func (ds *diskSegment) size() uint64 {
 	return ds.filesize
 }
 
-func loadKeyIndex(kf *memoryMappedFile, keyBlocks int64) [][]byte {
+func loadKeyIndex(kf *segmentFile, keyBlocks int64) ([][]byte, error) {
 	buffer := make([]byte, keyBlockSize)
 	keyIndex := make([][]byte, 0)
 
 	if kf.Length() == 0 {
-		return keyIndex
+		return keyIndex, nil
 	}
 
 	var block int64
 	for block = 0; block < keyBlocks; block += int64(keyIndexInterval) {
 		_, err := kf.ReadAt(buffer, block*keyBlockSize)
 		if err != nil {
-			keyIndex = nil
-			break
+			return nil, corruption(kf.name, block*keyBlockSize, err)
 		}
 		keylen := binary.LittleEndian.Uint16(buffer)
 		if keylen == endOfBlock {
 			break
 		}
+		// a block never starts with a compressed key
+		if keylen == 0 || keylen > maxKeySize {
+			return nil, corruption(kf.name, block*keyBlockSize, fmt.Errorf("invalid key length %d", keylen))
+		}
 		keycopy := make([]byte, keylen)
 		copy(keycopy, buffer[2:2+keylen])
 		keyIndex = append(keyIndex, keycopy)
 	}
-	return keyIndex
+	return keyIndex, nil
 }
 
 func (dsi *diskSegmentIterator) Next() (key []byte, value []byte, err error) {
@@ -259,6 +320,21 @@ func (dsi *diskSegmentIterator) peekKey() ([]byte, error) {
 	return dsi.key, dsi.err
 }
 
+func (dsi *diskSegmentIterator) valueSize() int {
+	return int(dsi.dataLen)
+}
+
+// corrupted ends the iteration with a CorruptionError at the current offset of the key file
+func (dsi *diskSegmentIterator) corrupted(err error) error {
+	dsi.err = corruption(dsi.segment.keyFile.name, dsi.block*keyBlockSize+int64(dsi.bufferOffset), err)
+	dsi.finished = true
+	dsi.isValid = true
+	dsi.key = nil
+	dsi.data = nil
+	dsi.dataLen = 0
+	return dsi.err
+}
+
 func (dsi *diskSegmentIterator) nextKeyValue() error {
 	if dsi.finished {
 		return EndOfIterator
@@ -266,6 +342,9 @@ func (dsi *diskSegmentIterator) nextKeyValue() error {
 	var prevKey = dsi.key
 
 	for {
+		if dsi.bufferOffset+2 > keyBlockSize {
+			return dsi.corrupted(errors.New("missing end of block"))
+		}
 		keylen := binary.LittleEndian.Uint16(dsi.buffer[dsi.bufferOffset:])
 		if keylen == endOfBlock {
 			dsi.block++
@@ -274,23 +353,27 @@ func (dsi *diskSegmentIterator) nextKeyValue() error {
 				dsi.err = EndOfIterator
 				dsi.key = nil
 				dsi.data = nil
+				dsi.dataLen = 0
 				dsi.isValid = true
 				return dsi.err
 			}
+			dsi.bufferOffset = 0
 			n, err := dsi.segment.keyFile.ReadAt(dsi.buffer, dsi.block*keyBlockSize)
-			if err != nil {
-				return err
+			if err == nil && n != keyBlockSize {
+				err = errors.New(fmt.Sprint("did not read block size, read ", n))
 			}
-			if n != keyBlockSize {
-				return errors.New(fmt.Sprint("did not read block size, read ", n))
+			if err != nil {
+				return dsi.corrupted(err)
 			}
-			dsi.bufferOffset = 0
 			prevKey = nil
 			continue
 		}
 		prefixLen, compressedLen, err := decodeKeyLen(keylen)
+		if err == nil && (dsi.bufferOffset+2+int(compressedLen)+12 > keyBlockSize || int(prefixLen) > len(prevKey)) {
+			err = fmt.Errorf("invalid key length %d", keylen)
+		}
 		if err != nil {
-			return err
+			return dsi.corrupted(err)
 		}
 
 		dsi.bufferOffset += 2
@@ -323,21 +406,34 @@ func (dsi *diskSegmentIterator) nextKeyValue() error {
 				dsi.isValid = true
 				dsi.key = nil
 				dsi.data = nil
+				dsi.dataLen = 0
 				dsi.err = EndOfIterator
 				return EndOfIterator
 			}
 		}
 	found:
 
-		if datalen == 0 {
+		dsi.dataLen = datalen
+		if datalen == 0 || dsi.mode == keysOnly {
 			dsi.data = emptyBytes
+		} else if dsi.mode == zeroCopy {
+			dsi.data, err = dsi.segment.dataFile.Slice(int64(dataoffset), int(datalen))
 		} else {
 			dsi.data = make([]byte, datalen)
-			_, err = dsi.segment.dataFile.ReadAt(dsi.data, int64(dataoffset))
+			var n int
+			n, err = dsi.segment.dataFile.ReadAt(dsi.data, int64(dataoffset))
+			if err == io.EOF && n == int(datalen) {
+				err = nil
+			}
+		}
+		if err != nil {
+			dsi.corrupted(err)
+			dsi.err = corruption(dsi.segment.dataFile.name, int64(dataoffset), err)
+			return dsi.err
 		}
 		dsi.key = key
 		dsi.isValid = true
-		return err
+		return nil
 	}
 }
 
@@ -349,12 +445,12 @@ func (ds *diskSegment) UpperID() uint64 {
 	return ds.upperID
 }
 
-func (ds *diskSegment) Put(key []byte, value []byte) ([]byte, error) {
-	panic("disk segments are immutable, unable to Put")
+func (ds *diskSegment) Put(key []byte, value []byte) error {
+	return ReadOnlySegment
 }
 
-func (ds *diskSegment) Remove(key []byte) ([]byte, error) {
-	panic("disk segments are immutable, unable to Remove")
+func (ds *diskSegment) Remove(key []byte) error {
+	return ReadOnlySegment
 }
 
 var emptyBytes = make([]byte, 0)
@@ -377,9 +473,21 @@ func (ds *diskSegment) Get(key []byte) ([]byte, error) {
 	return buffer, nil
 }
 
-func binarySearch(ds *diskSegment, key []byte) (offset int64, length uint32, err error) {
-	var buffer [maxKeySize]byte
+// GetUnsafe returns a value that refers directly to the memory mapped data file
+func (ds *diskSegment) GetUnsafe(key []byte) ([]byte, error) {
+	offset, len, err := binarySearch(ds, key)
+	if err != nil {
+		return nil, err
+	}
 
+	if len == 0 {
+		return emptyBytes, nil
+	}
+
+	return ds.dataFile.Slice(offset, int(len))
+}
+
+func binarySearch(ds *diskSegment, key []byte) (offset int64, length uint32, err error) {
 	// use memory index to narrow search
 	index := sort.Search(len(ds.keyIndex), func(i int) bool {
 		return less(key, ds.keyIndex[i])
@@ -398,7 +506,7 @@ func binarySearch(ds *diskSegment, key []byte) (offset int64, length uint32, err
 		highblock = ds.keyBlocks - 1
 	}
 
-	block, err := binarySearch0(ds, lowblock, highblock, key, buffer[:])
+	block, err := binarySearch0(ds, lowblock, highblock, key)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -406,13 +514,14 @@ func binarySearch(ds *diskSegment, key []byte) (offset int64, length uint32, err
 }
 
 // returns the block that may contain the key, or possible the next block - since we do not have a 'last key' of the block
-func binarySearch0(ds *diskSegment, lowBlock int64, highBlock int64, key []byte, buffer []byte) (int64, error) {
+func binarySearch0(ds *diskSegment, lowBlock int64, highBlock int64, key []byte) (int64, error) {
 	if highBlock-lowBlock <= 1 {
 		// the key is either in low block or high block, or does not exist, so check high block
-		ds.keyFile.ReadAt(buffer, highBlock*keyBlockSize)
-		keylen := binary.LittleEndian.Uint16(buffer)
-		skey := buffer[2 : 2+keylen]
-		if less(key, skey) {
+		before, err := lessThanFirstKey(ds, highBlock, key)
+		if err != nil {
+			return 0, err
+		}
+		if before {
 			return lowBlock, nil
 		} else {
 			return highBlock, nil
@@ -421,28 +530,49 @@ func binarySearch0(ds *diskSegment, lowBlock int64, highBlock int64, key []byte,
 
 	block := (highBlock-lowBlock)/2 + lowBlock
 
-	ds.keyFile.ReadAt(buffer, block*keyBlockSize)
-	keylen := binary.LittleEndian.Uint16(buffer)
-	skey := buffer[2 : 2+keylen]
+	before, err := lessThanFirstKey(ds, block, key)
+	if err != nil {
+		return 0, err
+	}
 
-	if less(key, skey) {
-		return binarySearch0(ds, lowBlock, block, key, buffer)
+	if before {
+		return binarySearch0(ds, lowBlock, block, key)
 	} else {
-		return binarySearch0(ds, block, highBlock, key, buffer)
+		return binarySearch0(ds, block, highBlock, key)
 	}
 }
 
-func scanBlock(ds *diskSegment, block int64, key []byte) (offset int64, len uint32, err error) {
-	var buffer [keyBlockSize]byte
+// lessThanFirstKey returns true if key is less than the first key of the block
+func lessThanFirstKey(ds *diskSegment, block int64, key []byte) (bool, error) {
+	buffer, pooled, err := ds.keyFile.readBlock(block*keyBlockSize, maxKeySize+2)
+	if err != nil {
+		return false, corruption(ds.keyFile.name, block*keyBlockSize, err)
+	}
+	defer releaseBlock(pooled)
+	keylen := binary.LittleEndian.Uint16(buffer)
+	if keylen == 0 || keylen > maxKeySize {
+		return false, corruption(ds.keyFile.name, block*keyBlockSize, fmt.Errorf("invalid key length %d", keylen))
+	}
+	return less(key, buffer[2:2+keylen]), nil
+}
 
-	_, err = ds.keyFile.ReadAt(buffer[:], block*keyBlockSize)
+func scanBlock(ds *diskSegment, block int64, key []byte) (offset int64, length uint32, err error) {
+	buffer, pooled, err := ds.keyFile.readBlock(block*keyBlockSize, keyBlockSize)
 	if err != nil {
 		return 0, 0, err
 	}
+	defer releaseBlock(pooled)
+
+	// the current key is expanded into keyBuffer, where the prefix shared with the previous key is already in place,
+	// so the block itself is never written
+	var keyBuffer [maxKeySize]byte
 
 	index := 0
-	var prevKey []byte = nil
+	prevLen := 0
 	for {
+		if index+2 > keyBlockSize {
+			return 0, 0, corruption(ds.keyFile.name, block*keyBlockSize+int64(index), errors.New("missing end of block"))
+		}
 		keylen := binary.LittleEndian.Uint16(buffer[index:])
 		if keylen == endOfBlock {
 			return 0, 0, KeyNotFound
@@ -457,20 +587,20 @@ func scanBlock(ds *diskSegment, block int64, key []byte) (offset int64, len uint
 		}
 
 		endkey := index + 2 + int(compressedLen)
-		_key := buffer[index+2 : endkey]
-
-		if prefixLen > 0 {
-			_key = append(prevKey[:prefixLen], _key...)
+		if endkey+12 > keyBlockSize || prefixLen > prevLen || prefixLen+int(compressedLen) > maxKeySize {
+			return 0, 0, corruption(ds.keyFile.name, block*keyBlockSize+int64(index), fmt.Errorf("invalid key length %d", keylen))
 		}
+		n := prefixLen + copy(keyBuffer[prefixLen:], buffer[index+2:endkey])
+		_key := keyBuffer[:n]
 
-		prevKey = _key
+		prevLen = n
 
-		if bytes.Equal(_key, key) {
+		switch bytes.Compare(_key, key) {
+		case 0:
 			offset = int64(binary.LittleEndian.Uint64(buffer[endkey:]))
-			len = binary.LittleEndian.Uint32(buffer[endkey+8:])
+			length = binary.LittleEndian.Uint32(buffer[endkey+8:])
 			return
-		}
-		if !less(_key, key) {
+		case 1:
 			return 0, 0, KeyNotFound
 		}
 		index = endkey + 12
@@ -478,6 +608,20 @@ func scanBlock(ds *diskSegment, block int64, key []byte) (offset int64, len uint
 }
 
 func (ds *diskSegment) Lookup(lower []byte, upper []byte) (LookupIterator, error) {
+	return ds.lookup(lower, upper, copyValues)
+}
+
+// LookupKeys only reads the key file, the data file is never accessed
+func (ds *diskSegment) LookupKeys(lower []byte, upper []byte) (LookupIterator, error) {
+	return ds.lookup(lower, upper, keysOnly)
+}
+
+// LookupUnsafe returns values that refer directly to the memory mapped data file
+func (ds *diskSegment) LookupUnsafe(lower []byte, upper []byte) (LookupIterator, error) {
+	return ds.lookup(lower, upper, zeroCopy)
+}
+
+func (ds *diskSegment) lookup(lower []byte, upper []byte, mode valueMode) (LookupIterator, error) {
 	if ds.keyFile.Length() == 0 {
 		return &emptyIterator{}, nil
 	}
@@ -500,7 +644,7 @@ func (ds *diskSegment) Lookup(lower []byte, upper []byte) (LookupIterator, error
 	if n != keyBlockSize {
 		return nil, errors.New(fmt.Sprint("did not read block size ", n))
 	}
-	return &diskSegmentIterator{segment: ds, lower: lower, upper: upper, buffer: buffer, block: block}, nil
+	return &diskSegmentIterator{segment: ds, lower: lower, upper: upper, buffer: buffer, block: block, mode: mode}, nil
 }
 
 func (ds *diskSegment) Close() error {
@@ -511,13 +655,12 @@ func (ds *diskSegment) Close() error {
 
 func (ds *diskSegment) removeSegment() error {
 	err0 := ds.Close()
-	err1 := os.Remove(ds.keyFile.Name())
-	err2 := os.Remove(ds.dataFile.Name())
+	err1 := ds.fs.Remove(ds.keyFile.Name())
+	err2 := ds.fs.Remove(ds.dataFile.Name())
 	return errn(err0, err1, err2)
 }
-func (ds *diskSegment) removeOnFinalize() {
-	//fmt.Println("scheduled ", ds.keyFile.Name(), "for deletion")
-	runtime.SetFinalizer(ds, func(ds *diskSegment) { ds.removeSegment() })
+func (ds *diskSegment) removeOnFinalize(remove func(s segment)) {
+	runtime.SetFinalizer(ds, func(ds *diskSegment) { remove(ds) })
 }
 func (ds *diskSegment) files() []string {
 	return []string{filepath.Base(ds.keyFile.Name()), filepath.Base(ds.dataFile.Name())}
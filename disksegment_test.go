@@ -18,7 +18,7 @@ func TestDiskSegment(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	ds, err := writeAndLoadSegment("test/keys.0.0", "test/data.0.0", itr, false)
+	ds, err := writeAndLoadSegment(Options{}, "test/keys.0.0", "test/data.0.0", itr, false)
 
 	itr, err = ds.Lookup(nil, nil)
 	if err != nil {
@@ -75,7 +75,7 @@ func TestLargeDiskSegment(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	ds, err := writeAndLoadSegment("test/keys.0.0", "test/data.0.0", itr, false)
+	ds, err := writeAndLoadSegment(Options{}, "test/keys.0.0", "test/data.0.0", itr, false)
 
 	itr, err = ds.Lookup(nil, nil)
 	count := 0
@@ -141,7 +141,7 @@ func TestEmptySegment(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	ds, err := writeAndLoadSegment("test/keys.0.0", "test/data.0.0", itr, false)
+	ds, err := writeAndLoadSegment(Options{}, "test/keys.0.0", "test/data.0.0", itr, false)
 
 	itr, err = ds.Lookup(nil, nil)
 	count := 0
@@ -171,7 +171,7 @@ func TestEmptySegmentWithPurge(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	ds, err := writeAndLoadSegment("test/keys.0.0", "test/data.0.0", itr, true)
+	ds, err := writeAndLoadSegment(Options{}, "test/keys.0.0", "test/data.0.0", itr, true)
 
 	itr, err = ds.Lookup(nil, nil)
 	count := 0
@@ -189,3 +189,107 @@ func TestEmptySegmentWithPurge(t *testing.T) {
 	os.RemoveAll("test")
 
 }
+
+func TestDiskSegmentLookupKeys(t *testing.T) {
+	os.RemoveAll("test")
+	os.Mkdir("test", os.ModePerm)
+	m := newMemoryOnlySegment()
+	m.Put([]byte("mykey"), []byte("myvalue"))
+	m.Put([]byte("mykey2"), []byte("myvalue22"))
+	m.Remove([]byte("mykey2"))
+	m.Put([]byte("mykey3"), []byte("myvalue333"))
+	itr, err := m.Lookup(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := writeAndLoadSegment(Options{}, "test/keys.0.0", "test/data.0.0", itr, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	itr, err = ds.LookupKeys(nil, nil)
+	if err != nil {
+		t.Fatal("unable to lookup", err)
+	}
+	sizes := []int{7, 0, 10}
+	for i, size := range sizes {
+		_, value, err := itr.Next()
+		if err != nil {
+			t.Fatal("iterator failed", err)
+		}
+		if len(value) != 0 {
+			t.Fatal("value should not be read", i)
+		}
+		if itr.valueSize() != size {
+			t.Fatal("incorrect value size", i, itr.valueSize(), size)
+		}
+	}
+	_, _, err = itr.Next()
+	if err != EndOfIterator {
+		t.Fatal("should be end of iterator", err)
+	}
+	os.RemoveAll("test")
+}
+
+// writeBenchmarkSegment writes a disk segment of n keys using the FileSystem of options
+func writeBenchmarkSegment(tb testing.TB, options Options, n int) segment {
+	os.RemoveAll("test")
+	os.Mkdir("test", os.ModePerm)
+	m := newMemoryOnlySegment()
+	for i := 0; i < n; i++ {
+		m.Put([]byte(fmt.Sprint("mykey", i)), []byte(fmt.Sprint("myvalue", i)))
+	}
+	itr, err := m.Lookup(nil, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	ds, err := writeAndLoadSegment(options, "test/keys.0.0", "test/data.0.0", itr, false)
+	if err != nil {
+		tb.Fatal("unable to write segment", err)
+	}
+	return ds
+}
+
+func TestDiskSegment_GetAllocs(t *testing.T) {
+	ds := writeBenchmarkSegment(t, Options{}, 100000)
+	defer ds.Close()
+	if ds.(*diskSegment).keyFile.data == nil {
+		t.Skip("the key file is not memory mapped")
+	}
+	key := []byte("mykey12345")
+	allocs := testing.AllocsPerRun(100, func() {
+		value, err := ds.GetUnsafe(key)
+		if err != nil || string(value) != "myvalue12345" {
+			t.Fatal("incorrect value", string(value), err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatal("reading a memory mapped segment should not allocate", allocs)
+	}
+}
+
+func benchmarkDiskSegmentGet(b *testing.B, options Options) {
+	n := 100000
+	ds := writeBenchmarkSegment(b, options, n)
+	defer ds.Close()
+	keys := make([][]byte, 1000)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprint("mykey", (i*7919)%n))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := ds.Get(keys[i%len(keys)])
+		if err != nil {
+			b.Fatal("unable to get", err)
+		}
+	}
+}
+
+func BenchmarkDiskSegment_Get(b *testing.B) {
+	benchmarkDiskSegmentGet(b, Options{})
+}
+
+func BenchmarkDiskSegment_GetPread(b *testing.B) {
+	benchmarkDiskSegmentGet(b, Options{FileSystem: NewPreadFileSystem()})
+}
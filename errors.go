@@ -1,6 +1,13 @@
 package leveldb
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The sentinel errors. Errors returned by the database may wrap a sentinel to add context, so use errors.Is
+// rather than == to test for them, except for KeyNotFound and EndOfIterator which are never wrapped.
 
 var KeyNotFound = errors.New("key not found")
 var KeyTooLong = errors.New("key too long, max 1024")
@@ -14,6 +21,189 @@ var NotADirectory = errors.New("path is not a directory")
 var NotValidDatabase = errors.New("path is not a valid database")
 var EndOfIterator = errors.New("end of iterator")
 var ReadOnlySegment = errors.New("read only segment")
+var InvalidWriteOptions = errors.New("sync requires the write ahead log")
+var InvalidOptions = errors.New("invalid options")
+var IncompatibleOptions = errors.New("options are incompatible with the database")
+var BackgroundError = errors.New("database failed due to a background error, see Database.Resume")
+
+var IOError = errors.New("i/o error")
+var DatabaseReadOnly = errors.New("database is read only")
+
+// Code identifies a sentinel error, so that errors can be transmitted by remote clients, see CodeOf and FromCode
+type Code int
+
+const (
+	UnknownCode Code = iota
+	KeyNotFoundCode
+	KeyTooLongCode
+	EmptyKeyCode
+	DatabaseClosedCode
+	DatabaseInUseCode
+	SnapshotClosedCode
+	NoDatabaseFoundCode
+	DatabaseCorruptedCode
+	NotADirectoryCode
+	NotValidDatabaseCode
+	EndOfIteratorCode
+	ReadOnlySegmentCode
+	InvalidWriteOptionsCode
+	InvalidOptionsCode
+	IncompatibleOptionsCode
+	BackgroundErrorCode
+	IOErrorCode
+	DatabaseReadOnlyCode
+)
+
+// sentinels is indexed by Code
+var sentinels = []error{
+	UnknownCode:             nil,
+	KeyNotFoundCode:         KeyNotFound,
+	KeyTooLongCode:          KeyTooLong,
+	EmptyKeyCode:            EmptyKey,
+	DatabaseClosedCode:      DatabaseClosed,
+	DatabaseInUseCode:       DatabaseInUse,
+	SnapshotClosedCode:      SnapshotClosed,
+	NoDatabaseFoundCode:     NoDatabaseFound,
+	DatabaseCorruptedCode:   DatabaseCorrupted,
+	NotADirectoryCode:       NotADirectory,
+	NotValidDatabaseCode:    NotValidDatabase,
+	EndOfIteratorCode:       EndOfIterator,
+	ReadOnlySegmentCode:     ReadOnlySegment,
+	InvalidWriteOptionsCode: InvalidWriteOptions,
+	InvalidOptionsCode:      InvalidOptions,
+	IncompatibleOptionsCode: IncompatibleOptions,
+	BackgroundErrorCode:     BackgroundError,
+	IOErrorCode:             IOError,
+	DatabaseReadOnlyCode:    DatabaseReadOnly,
+}
+
+// Sentinel returns the sentinel error of the code, or nil for UnknownCode
+func (c Code) Sentinel() error {
+	if c <= UnknownCode || int(c) >= len(sentinels) {
+		return nil
+	}
+	return sentinels[c]
+}
+
+func (c Code) String() string {
+	if err := c.Sentinel(); err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("unknown error code %d", int(c))
+}
+
+// CodeOf returns the code of the sentinel error matched by err, or UnknownCode
+func CodeOf(err error) Code {
+	if err == nil {
+		return UnknownCode
+	}
+	var e *Error
+	if errors.As(err, &e) && e.Code.Sentinel() != nil {
+		return e.Code
+	}
+	for code, sentinel := range sentinels {
+		if sentinel != nil && errors.Is(err, sentinel) {
+			return Code(code)
+		}
+	}
+	return UnknownCode
+}
+
+// FromCode returns an error for a code and message received from a remote database, which matches the sentinel
+// error of the code with errors.Is. The sentinel itself is returned if the message has no further context.
+func FromCode(code Code, message string) error {
+	sentinel := code.Sentinel()
+	if sentinel == nil {
+		return errors.New(message)
+	}
+	message = strings.TrimPrefix(strings.TrimPrefix(message, sentinel.Error()), ": ")
+	if message == "" {
+		return sentinel
+	}
+	return &Error{Code: code, Err: errors.New(message)}
+}
+
+// Error is an error with the context in which it occurred. It matches the sentinel error of its Code with
+// errors.Is, and unwraps to its cause.
+type Error struct {
+	Code Code
+	// path of the database or file, if known
+	Path string
+	// the segment being read or written, if any
+	Segment *SegmentID
+	// the key being accessed, only set for errors caused by the key itself
+	Key []byte
+	// the cause, may be nil
+	Err error
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Code.String())
+	if e.Path != "" {
+		b.WriteString(": " + e.Path)
+	}
+	if e.Segment != nil {
+		fmt.Fprintf(&b, " segment %d.%d", e.Segment.Lower, e.Segment.Upper)
+	}
+	if e.Key != nil {
+		fmt.Fprintf(&b, " key %q", e.Key)
+	}
+	if e.Err != nil {
+		b.WriteString(": " + e.Err.Error())
+	}
+	return b.String()
+}
+func (e *Error) Unwrap() error { return e.Err }
+func (e *Error) Is(target error) bool {
+	sentinel := e.Code.Sentinel()
+	return sentinel != nil && target == sentinel
+}
+
+// ioError adds the path and segment to an error reading or writing the segment, unless it already has context
+func ioError(path string, id SegmentID, err error) error {
+	var e *Error
+	var corrupt *CorruptionError
+	if errors.As(err, &e) || errors.As(err, &corrupt) {
+		return err
+	}
+	return &Error{Code: IOErrorCode, Path: path, Segment: &id, Err: err}
+}
+
+// CorruptionError is returned when a file of the database contains invalid data, it matches DatabaseCorrupted
+type CorruptionError struct {
+	// path of the file
+	File string
+	// offset of the invalid data in the file
+	Offset int64
+	// the cause, or a description of the invalid data
+	Err error
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("%s: %s at offset %d: %s", DatabaseCorrupted, e.File, e.Offset, e.Err)
+}
+func (e *CorruptionError) Unwrap() error        { return e.Err }
+func (e *CorruptionError) Is(target error) bool { return target == DatabaseCorrupted }
+
+func corruption(file string, offset int64, err error) error {
+	return &CorruptionError{File: file, Offset: offset, Err: err}
+}
+
+// InvalidFileError is returned when the database directory contains a file that does not belong to a database,
+// it matches NotValidDatabase
+type InvalidFileError struct {
+	// path of the file
+	File string
+	// the cause, or a description of the problem
+	Err error
+}
+
+func (e *InvalidFileError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", NotValidDatabase, e.File, e.Err)
+}
+func (e *InvalidFileError) Unwrap() error        { return e.Err }
+func (e *InvalidFileError) Is(target error) bool { return target == NotValidDatabase }
 
 // returns the first non-nil error
 func errn(errs ...error) error {
@@ -25,7 +215,9 @@ func errn(errs ...error) error {
 	return nil
 }
 
-// MapError maps err to a leveldb error, or returns a new error for err
+// MapError maps the message of a sentinel error to the sentinel, or returns a new error for err. The message of a
+// wrapped error starts with the message of its sentinel, so it is mapped to the sentinel as well. FromCode
+// preserves the context of wrapped errors.
 func MapError(err string) error {
 	switch err {
 	case KeyNotFound.Error():
@@ -50,7 +242,24 @@ func MapError(err string) error {
 		return EndOfIterator
 	case ReadOnlySegment.Error():
 		return ReadOnlySegment
+	case InvalidWriteOptions.Error():
+		return InvalidWriteOptions
+	case InvalidOptions.Error():
+		return InvalidOptions
+	case IncompatibleOptions.Error():
+		return IncompatibleOptions
+	case BackgroundError.Error():
+		return BackgroundError
+	case IOError.Error():
+		return IOError
+	case DatabaseReadOnly.Error():
+		return DatabaseReadOnly
 	default:
+		for _, sentinel := range sentinels {
+			if sentinel != nil && strings.HasPrefix(err, sentinel.Error()+": ") {
+				return sentinel
+			}
+		}
 		return errors.New(err)
 	}
 }
@@ -0,0 +1,110 @@
+package leveldb
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// EventListener receives notifications of the background activity of a database, see Options.EventListener.
+// The callbacks are called synchronously by the goroutine performing the activity, possibly while holding
+// internal locks, so they must return quickly and must not call the Database.
+type EventListener interface {
+	// OnFlushBegin is called before a memory segment or log segment is written to disk
+	OnFlushBegin(info FlushInfo)
+	// OnFlushEnd is called after a memory segment or log segment was written to disk, or the write failed
+	OnFlushEnd(info FlushInfo)
+	// OnMergeBegin is called before segments are merged
+	OnMergeBegin(info MergeInfo)
+	// OnMergeEnd is called after segments were merged, or the merge failed
+	OnMergeEnd(info MergeInfo)
+	// OnWriteStall is called after a write was paused waiting for the flusher
+	OnWriteStall(info WriteStallInfo)
+	// OnBackgroundError is called when a background flush or merge fails, after which the database cannot be written
+	// until Database.Resume()
+	OnBackgroundError(err error)
+	// OnSegmentDeleted is called after the files of a segment that is no longer needed were removed
+	OnSegmentDeleted(info SegmentDeletedInfo)
+}
+
+// SegmentID identifies a segment by the range of the ids of the memory segments it contains
+type SegmentID struct {
+	Lower uint64
+	Upper uint64
+}
+
+func segmentID(s segment) SegmentID {
+	return SegmentID{Lower: s.LowerID(), Upper: s.UpperID()}
+}
+
+type FlushInfo struct {
+	Path    string
+	Segment SegmentID
+	// size of the disk segment, only set by OnFlushEnd
+	Bytes    uint64
+	Duration time.Duration
+	Err      error
+}
+
+type MergeInfo struct {
+	Path          string
+	InputSegments []SegmentID
+	OutputSegment SegmentID
+	BytesRead     uint64
+	// size of the merged segment, only set by OnMergeEnd
+	BytesWritten uint64
+	Duration     time.Duration
+	Err          error
+}
+
+type WriteStallInfo struct {
+	Path string
+	// number of immutable segments waiting to be written to disk when the write was paused
+	ImmutableSegments int
+	Duration          time.Duration
+}
+
+type SegmentDeletedInfo struct {
+	Path string
+	// names of the removed files
+	Files []string
+}
+
+// NoopEventListener ignores all events, and can be embedded to implement only some of the callbacks
+type NoopEventListener struct{}
+
+func (NoopEventListener) OnFlushBegin(info FlushInfo)              {}
+func (NoopEventListener) OnFlushEnd(info FlushInfo)                {}
+func (NoopEventListener) OnMergeBegin(info MergeInfo)              {}
+func (NoopEventListener) OnMergeEnd(info MergeInfo)                {}
+func (NoopEventListener) OnWriteStall(info WriteStallInfo)         {}
+func (NoopEventListener) OnBackgroundError(err error)              {}
+func (NoopEventListener) OnSegmentDeleted(info SegmentDeletedInfo) {}
+
+// events returns the EventListener of the database
+func (db *Database) events() EventListener {
+	if listener := db.getOptions().EventListener; listener != nil {
+		return listener
+	}
+	return NoopEventListener{}
+}
+
+// segmentDeleted reports the removed files, if any
+func (db *Database) segmentDeleted(files []string) {
+	if len(files) > 0 {
+		db.logger().Info("deleted segment files", "files", files)
+		db.events().OnSegmentDeleted(SegmentDeletedInfo{Path: db.path, Files: files})
+	}
+}
+
+// backgroundError records an error of the flusher or merger, after which the database cannot be written until
+// Resume()
+func (db *Database) backgroundError(err error) {
+	db.Lock()
+	db.err = err
+	db.errTime = time.Now()
+	atomic.StoreInt32(&db.failed, 1)
+	db.flushed.Broadcast()
+	db.Unlock()
+	db.logger().Error("background error", "error", err)
+	db.events().OnBackgroundError(err)
+}
@@ -0,0 +1,202 @@
+package leveldb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testListener struct {
+	NoopEventListener
+	mu      sync.Mutex
+	flushes []FlushInfo
+	merges  []MergeInfo
+	stalls  []WriteStallInfo
+	errs    []error
+	deleted []string
+}
+
+func (l *testListener) OnFlushEnd(info FlushInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flushes = append(l.flushes, info)
+}
+func (l *testListener) OnMergeEnd(info MergeInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.merges = append(l.merges, info)
+}
+func (l *testListener) OnWriteStall(info WriteStallInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stalls = append(l.stalls, info)
+}
+func (l *testListener) OnBackgroundError(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errs = append(l.errs, err)
+}
+func (l *testListener) OnSegmentDeleted(info SegmentDeletedInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.deleted = append(l.deleted, info.Files...)
+}
+
+func TestEventListener(t *testing.T) {
+	listener := &testListener{}
+	options := Options{CreateIfNeeded: true, DisableAutoMerge: true, FileSystem: NewMemFileSystem(), EventListener: listener}
+
+	db, err := Open("test/eventsdb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	for i := 0; i < 2; i++ {
+		err = db.Put([]byte(fmt.Sprint("mykey", i)), []byte("myvalue"))
+		if err != nil {
+			t.Fatal("unable to put key/value", err)
+		}
+		err = db.flushMemory()
+		if err != nil {
+			t.Fatal("unable to flush memory", err)
+		}
+		waitForFlush(t, db)
+	}
+	err = mergeSegments0(db, 1, false)
+	if err != nil {
+		t.Fatal("unable to merge", err)
+	}
+
+	listener.mu.Lock()
+	if len(listener.flushes) != 2 || listener.flushes[0].Segment != (SegmentID{1, 1}) || listener.flushes[0].Bytes == 0 || listener.flushes[0].Err != nil {
+		t.Fatal("incorrect flush events", listener.flushes)
+	}
+	if len(listener.merges) != 1 || len(listener.merges[0].InputSegments) != 2 || listener.merges[0].OutputSegment != (SegmentID{1, 2}) || listener.merges[0].BytesWritten == 0 {
+		t.Fatal("incorrect merge events", listener.merges)
+	}
+	if len(listener.deleted) != 2 || listener.deleted[0] != "log.1" {
+		t.Fatal("incorrect deleted events", listener.deleted)
+	}
+	listener.mu.Unlock()
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	deleted := strings.Join(listener.deleted, ",")
+	if !strings.Contains(deleted, "keys.1.1") || !strings.Contains(deleted, "data.2.2") {
+		t.Fatal("merged segments should be deleted on close", deleted)
+	}
+}
+
+func TestEventListener_BackgroundError(t *testing.T) {
+	listener := &testListener{}
+	ffs := newFaultFileSystem()
+	options := Options{CreateIfNeeded: true, DisableAutoMerge: true, FileSystem: ffs, EventListener: listener}
+
+	db, err := Open("test/eventsdb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	err = db.Put([]byte("mykey"), []byte("myvalue"))
+	if err != nil {
+		t.Fatal("unable to put key/value", err)
+	}
+	ffs.fail = func(op, name string) error {
+		if op == "create" && strings.Contains(name, "keys.") {
+			return errors.New("injected failure")
+		}
+		return nil
+	}
+	err = db.flushMemory()
+	if err != nil {
+		t.Fatal("unable to flush memory", err)
+	}
+	for i := 0; ; i++ {
+		listener.mu.Lock()
+		n := len(listener.errs)
+		listener.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if i == 1000 {
+			t.Fatal("background error was not reported")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	listener.mu.Lock()
+	if len(listener.flushes) != 1 || listener.flushes[0].Err == nil {
+		t.Fatal("failed flush should be reported", listener.flushes)
+	}
+	listener.mu.Unlock()
+	if db.Close() == nil {
+		t.Fatal("close should fail after a background error")
+	}
+}
+
+func TestEventListener_WriteStall(t *testing.T) {
+	listener := &testListener{}
+	ffs := newFaultFileSystem()
+	// the flusher is blocked until the writer is waiting for it
+	release := make(chan struct{})
+	ffs.beforeCreate = func(name string) {
+		if strings.Contains(name, "keys.") {
+			<-release
+		}
+	}
+	options := Options{CreateIfNeeded: true, DisableAutoMerge: true, MaxImmutableMemtables: 1, FileSystem: ffs, EventListener: listener}
+
+	db, err := Open("test/eventsdb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	err = db.Put([]byte("mykey"), []byte("myvalue"))
+	if err != nil {
+		t.Fatal("unable to put key/value", err)
+	}
+	err = db.flushMemory()
+	if err != nil {
+		t.Fatal("unable to flush memory", err)
+	}
+	err = db.Put([]byte("mykey2"), []byte("myvalue2"))
+	if err != nil {
+		t.Fatal("unable to put key/value", err)
+	}
+
+	// the immutable segment cannot be written, so the writer stalls waiting on db.flushed, which releases the lock
+	locked := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		db.Lock()
+		close(locked)
+		err := db.swapMemory()
+		db.Unlock()
+		done <- err
+	}()
+	<-locked
+	db.Lock()
+	db.Unlock()
+	close(release)
+	err = <-done
+	if err != nil {
+		t.Fatal("unable to swap memory", err)
+	}
+
+	listener.mu.Lock()
+	if len(listener.stalls) != 1 || listener.stalls[0].Duration == 0 || listener.stalls[0].ImmutableSegments != 1 {
+		t.Fatal("incorrect write stall events", listener.stalls)
+	}
+	listener.mu.Unlock()
+	if db.Stats().Stalls != 1 {
+		t.Fatal("stalls should be counted")
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+}
@@ -0,0 +1,333 @@
+package leveldb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var errCrashed = errors.New("faultfs: crashed")
+
+// faultFileSystem is an in memory FileSystem for crash testing. It tracks which file contents and directory entries
+// have been synced, can fail specific operations, and can crash after a number of operations. After a crash every
+// operation fails, and crash() returns a new FileSystem with the state that survived, either after the process was
+// killed (all written data survives) or after a power loss (only synced data and directory entries survive).
+type faultFileSystem struct {
+	mu    sync.Mutex
+	files map[string]*faultFile
+	// the directory entries as of the last SyncDir
+	durable map[string]*faultFile
+	dirs    map[string]bool
+	locks   map[string]bool
+	// number of operations performed
+	ops int
+	// if > 0, the operation number at which the file system crashes
+	crashAt int
+	crashed bool
+	// if non-nil, called before every operation and the operation fails if an error is returned
+	fail func(op, name string) error
+	// if non-nil, called without the lock before a file is created, so that it can block the caller
+	beforeCreate func(name string)
+}
+
+type faultFile struct {
+	data   []byte
+	synced int
+}
+
+func newFaultFileSystem() *faultFileSystem {
+	return &faultFileSystem{files: make(map[string]*faultFile), durable: make(map[string]*faultFile), dirs: make(map[string]bool), locks: make(map[string]bool)}
+}
+
+// check must be called with the lock held before performing op
+func (ffs *faultFileSystem) check(op, name string) error {
+	if ffs.crashed {
+		return errCrashed
+	}
+	ffs.ops++
+	if ffs.crashAt > 0 && ffs.ops >= ffs.crashAt {
+		ffs.crashed = true
+		return errCrashed
+	}
+	if ffs.fail != nil {
+		return ffs.fail(op, name)
+	}
+	return nil
+}
+
+// operations returns the number of operations performed
+func (ffs *faultFileSystem) operations() int {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	return ffs.ops
+}
+
+// crash stops all further operations and returns a new file system with the surviving state. If powerLoss is
+// true, any data that was not synced is lost.
+func (ffs *faultFileSystem) crash(powerLoss bool) *faultFileSystem {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+
+	ffs.crashed = true
+
+	survivor := newFaultFileSystem()
+	files := ffs.files
+	if powerLoss {
+		files = ffs.durable
+	}
+	for name, f := range files {
+		data := f.data
+		if powerLoss {
+			data = data[:f.synced]
+		}
+		f = &faultFile{data: append([]byte(nil), data...), synced: len(data)}
+		survivor.files[name] = f
+		survivor.durable[name] = f
+	}
+	for name := range ffs.dirs {
+		survivor.dirs[name] = true
+	}
+	return survivor
+}
+
+func (ffs *faultFileSystem) create(op, name string, truncate bool) (WritableFile, error) {
+	if ffs.beforeCreate != nil {
+		ffs.beforeCreate(name)
+	}
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if err := ffs.check(op, name); err != nil {
+		return nil, err
+	}
+	if !ffs.dirs[filepath.Dir(name)] {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	f, ok := ffs.files[name]
+	if !ok || truncate {
+		f = &faultFile{}
+		ffs.files[name] = f
+	}
+	return &faultWritableFile{fs: ffs, file: f, name: name}, nil
+}
+
+func (ffs *faultFileSystem) Create(name string) (WritableFile, error) {
+	return ffs.create("create", name, true)
+}
+
+func (ffs *faultFileSystem) Append(name string) (WritableFile, error) {
+	return ffs.create("append", name, false)
+}
+
+func (ffs *faultFileSystem) Open(name string) (RandomAccessFile, error) {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if err := ffs.check("open", name); err != nil {
+		return nil, err
+	}
+	f, ok := ffs.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return &memRandomAccessFile{data: f.data[:len(f.data):len(f.data)]}, nil
+}
+
+func (ffs *faultFileSystem) Rename(oldname, newname string) error {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+
+	oldname, newname = filepath.Clean(oldname), filepath.Clean(newname)
+	if err := ffs.check("rename", oldname); err != nil {
+		return err
+	}
+	f, ok := ffs.files[oldname]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	delete(ffs.files, oldname)
+	ffs.files[newname] = f
+	return nil
+}
+
+func (ffs *faultFileSystem) Remove(name string) error {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if err := ffs.check("remove", name); err != nil {
+		return err
+	}
+	if _, ok := ffs.files[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(ffs.files, name)
+	return nil
+}
+
+func (ffs *faultFileSystem) RemoveAll(path string) error {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+
+	path = filepath.Clean(path)
+	if err := ffs.check("removeall", path); err != nil {
+		return err
+	}
+	prefix := path + string(filepath.Separator)
+	for name := range ffs.files {
+		if strings.HasPrefix(name, prefix) {
+			delete(ffs.files, name)
+			delete(ffs.durable, name)
+		}
+	}
+	for name := range ffs.dirs {
+		if name == path || strings.HasPrefix(name, prefix) {
+			delete(ffs.dirs, name)
+		}
+	}
+	return nil
+}
+
+func (ffs *faultFileSystem) MkdirAll(path string) error {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+
+	path = filepath.Clean(path)
+	if err := ffs.check("mkdir", path); err != nil {
+		return err
+	}
+	for {
+		ffs.dirs[path] = true
+		parent := filepath.Dir(path)
+		if parent == path {
+			return nil
+		}
+		path = parent
+	}
+}
+
+func (ffs *faultFileSystem) List(dir string) ([]string, error) {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+
+	dir = filepath.Clean(dir)
+	if err := ffs.check("list", dir); err != nil {
+		return nil, err
+	}
+	if !ffs.dirs[dir] {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: os.ErrNotExist}
+	}
+	names := make([]string, 0)
+	for name := range ffs.files {
+		if filepath.Dir(name) == dir {
+			names = append(names, filepath.Base(name))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (ffs *faultFileSystem) SyncDir(dir string) error {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+
+	dir = filepath.Clean(dir)
+	if err := ffs.check("syncdir", dir); err != nil {
+		return err
+	}
+	for name := range ffs.durable {
+		if filepath.Dir(name) == dir {
+			delete(ffs.durable, name)
+		}
+	}
+	for name, f := range ffs.files {
+		if filepath.Dir(name) == dir {
+			ffs.durable[name] = f
+		}
+	}
+	return nil
+}
+
+func (ffs *faultFileSystem) Stat(name string) (fs.FileInfo, error) {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if err := ffs.check("stat", name); err != nil {
+		return nil, err
+	}
+	if f, ok := ffs.files[name]; ok {
+		return &memFileInfo{name: filepath.Base(name), size: int64(len(f.data))}, nil
+	}
+	if ffs.dirs[name] {
+		return &memFileInfo{name: filepath.Base(name), dir: true}, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+type faultLock struct {
+	fs   *faultFileSystem
+	name string
+}
+
+func (l *faultLock) Close() error {
+	l.fs.mu.Lock()
+	defer l.fs.mu.Unlock()
+	delete(l.fs.locks, l.name)
+	return nil
+}
+
+func (ffs *faultFileSystem) Lock(name string) (io.Closer, error) {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if err := ffs.check("lock", name); err != nil {
+		return nil, err
+	}
+	if ffs.locks[name] {
+		return nil, fmt.Errorf("%s is locked", name)
+	}
+	ffs.locks[name] = true
+	return &faultLock{fs: ffs, name: name}, nil
+}
+
+type faultWritableFile struct {
+	fs   *faultFileSystem
+	file *faultFile
+	name string
+}
+
+func (f *faultWritableFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.fs.check("write", f.name); err != nil {
+		return 0, err
+	}
+	f.file.data = append(f.file.data, p...)
+	return len(p), nil
+}
+
+func (f *faultWritableFile) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.fs.check("sync", f.name); err != nil {
+		return err
+	}
+	f.file.synced = len(f.file.data)
+	return nil
+}
+
+func (f *faultWritableFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return f.fs.check("close", f.name)
+}
@@ -0,0 +1,200 @@
+package leveldb
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	"github.com/nightlyone/lockfile"
+)
+
+// FileSystem abstracts all file access performed by the database, allowing alternative storage to be
+// used via Options.FileSystem. Names are full paths as constructed using filepath.Join on the database path.
+type FileSystem interface {
+	// Create creates or truncates the named file for sequential writing
+	Create(name string) (WritableFile, error)
+	// Append opens the named file for sequential writing at the end of the file, creating it if needed
+	Append(name string) (WritableFile, error)
+	// Open opens the named file for random access reading
+	Open(name string) (RandomAccessFile, error)
+	Rename(oldname, newname string) error
+	Remove(name string) error
+	RemoveAll(path string) error
+	MkdirAll(path string) error
+	// List returns the names (not paths) of the entries in the directory in sorted order
+	List(dir string) ([]string, error)
+	// SyncDir commits the directory entries (created, renamed and removed files) to stable storage
+	SyncDir(dir string) error
+	Stat(name string) (fs.FileInfo, error)
+	// Lock acquires an exclusive lock using the named file, the lock is released by closing the returned Closer
+	Lock(name string) (io.Closer, error)
+}
+
+// WritableFile is a file opened for sequential writing
+type WritableFile interface {
+	io.Writer
+	io.Closer
+	// Sync commits the written data to stable storage
+	Sync() error
+}
+
+// RandomAccessFile is a file opened for reading
+type RandomAccessFile interface {
+	io.ReaderAt
+	io.Closer
+	// Len returns the length of the file at the time it was opened
+	Len() int
+	// Slice returns length bytes at off. If the file is held in memory the returned slice may refer directly
+	// to that memory, in which case it is only valid until Close.
+	Slice(off int64, length int) ([]byte, error)
+}
+
+type osFileSystem struct {
+	mmap bool
+}
+
+var defaultFileSystem = NewOSFileSystem()
+
+// NewOSFileSystem returns the default FileSystem which uses the os package, and memory maps the segment files
+func NewOSFileSystem() FileSystem {
+	return &osFileSystem{mmap: true}
+}
+
+// NewPreadFileSystem returns a FileSystem which uses the os package, but reads files using ReadAt rather than
+// memory mapping them. This is useful on platforms without mmap support, or to limit the virtual memory used.
+func NewPreadFileSystem() FileSystem {
+	return &osFileSystem{mmap: false}
+}
+
+func (osfs *osFileSystem) Create(name string) (WritableFile, error) {
+	return os.OpenFile(name, os.O_TRUNC|os.O_WRONLY|os.O_CREATE, 0644)
+}
+
+func (osfs *osFileSystem) Append(name string) (WritableFile, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+}
+
+func (osfs *osFileSystem) Open(name string) (RandomAccessFile, error) {
+	if osfs.mmap {
+		return openMappedFile(name)
+	}
+	return openPreadFile(name)
+}
+
+func (osfs *osFileSystem) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+func (osfs *osFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osfs *osFileSystem) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (osfs *osFileSystem) MkdirAll(path string) error {
+	return os.MkdirAll(path, os.ModePerm)
+}
+
+func (osfs *osFileSystem) List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (osfs *osFileSystem) SyncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		// directories cannot be opened for syncing, and the entries are durable once the files are synced
+		return nil
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	return errn(err, f.Close())
+}
+
+func (osfs *osFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+type osLock struct {
+	lf lockfile.Lockfile
+}
+
+func (l *osLock) Close() error {
+	return l.lf.Unlock()
+}
+
+func (osfs *osFileSystem) Lock(name string) (io.Closer, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+	lf, err := lockfile.New(abs)
+	if err != nil {
+		return nil, err
+	}
+	err = lf.TryLock()
+	if err != nil {
+		return nil, err
+	}
+	return &osLock{lf: lf}, nil
+}
+
+// preadFile reads using ReadAt on the underlying os.File
+type preadFile struct {
+	file   *os.File
+	length int
+}
+
+func openPreadFile(name string) (RandomAccessFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &preadFile{file: f, length: int(info.Size())}, nil
+}
+
+func (pf *preadFile) ReadAt(buffer []byte, off int64) (int, error) {
+	return pf.file.ReadAt(buffer, off)
+}
+
+func (pf *preadFile) Len() int {
+	return pf.length
+}
+
+func (pf *preadFile) Slice(off int64, length int) ([]byte, error) {
+	buffer := make([]byte, length)
+	_, err := pf.file.ReadAt(buffer, off)
+	if err != nil {
+		return nil, err
+	}
+	return buffer, nil
+}
+
+func (pf *preadFile) Close() error {
+	if pf.file == nil {
+		return nil
+	}
+	f := pf.file
+	pf.file = nil
+	return f.Close()
+}
@@ -0,0 +1,106 @@
+package leveldb_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/robaho/leveldb"
+)
+
+func testFileSystem(t *testing.T, fs leveldb.FileSystem) {
+	options := leveldb.Options{CreateIfNeeded: true, DisableAutoMerge: true, FileSystem: fs}
+
+	leveldb.RemoveWithOptions("test/fsdb", options)
+
+	for i := 0; i < 10; i++ {
+		db, err := leveldb.Open("test/fsdb", options)
+		if err != nil {
+			t.Fatal("unable to create database", err)
+		}
+		for j := 0; j < 100; j++ {
+			err = db.Put([]byte(fmt.Sprint("mykey", i*100+j)), []byte(fmt.Sprint("myvalue", i*100+j)))
+			if err != nil {
+				t.Fatal("unable to put key/value", err)
+			}
+		}
+		_, err = db.Remove([]byte(fmt.Sprint("mykey", i*100)))
+		if err != nil {
+			t.Fatal("unable to remove key", err)
+		}
+		err = db.CloseWithMerge(0)
+		if err != nil {
+			t.Fatal("unable to close database", err)
+		}
+	}
+
+	db, err := leveldb.Open("test/fsdb", options)
+	if err != nil {
+		t.Fatal("unable to open database", err)
+	}
+	err = db.CloseWithMerge(1)
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+
+	db, err = leveldb.Open("test/fsdb", options)
+	if err != nil {
+		t.Fatal("unable to open database", err)
+	}
+	value, err := db.Get([]byte("mykey101"))
+	if err != nil || string(value) != "myvalue101" {
+		t.Fatal("incorrect value", string(value), err)
+	}
+	_, err = db.Get([]byte("mykey100"))
+	if err != leveldb.KeyNotFound {
+		t.Fatal("should not of found removed key", err)
+	}
+	itr, err := db.LookupKeys(nil, nil)
+	if err != nil {
+		t.Fatal("unable to open iterator", err)
+	}
+	count := 0
+	for {
+		_, err = itr.Next()
+		if err != nil {
+			break
+		}
+		count++
+	}
+	if count != 990 {
+		t.Fatal("incorrect count, should be 990, is ", count)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+	err = leveldb.RemoveWithOptions("test/fsdb", options)
+	if err != nil {
+		t.Fatal("unable to remove database", err)
+	}
+}
+
+func TestMemFileSystem(t *testing.T) {
+	os.RemoveAll("test/fsdb")
+	fs := leveldb.NewMemFileSystem()
+	testFileSystem(t, fs)
+	if _, err := os.Stat("test/fsdb"); !os.IsNotExist(err) {
+		t.Fatal("memory file system should not create files", err)
+	}
+
+	options := leveldb.Options{CreateIfNeeded: true, FileSystem: fs}
+	db, err := leveldb.Open("test/fsdb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	_, err = leveldb.Open("test/fsdb", options)
+	if !errors.Is(err, leveldb.DatabaseInUse) {
+		t.Fatal("database should be in use", err)
+	}
+	db.Close()
+}
+
+func TestPreadFileSystem(t *testing.T) {
+	testFileSystem(t, leveldb.NewPreadFileSystem())
+}
@@ -0,0 +1,136 @@
+package leveldb
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// flush the immutable memory segments and the log segments of the database to disk
+func flushSegments(db *Database) {
+	defer db.wg.Done()
+
+	for {
+		select {
+		case <-time.After(time.Second):
+			break
+		case <-db.flusher:
+			break
+		}
+		if atomic.LoadInt32(&db.closing) > 0 {
+			return
+		}
+		if atomic.LoadInt32(&db.failed) > 0 {
+			// wait for Resume()
+			continue
+		}
+		if !atomic.CompareAndSwapInt32(&db.flushRequested, 1, 0) {
+			// the immutable segments of snapshots are kept in memory until a flush is requested
+			continue
+		}
+
+		err := flushSegments0(db)
+		if err != nil {
+			db.backgroundError(fmt.Errorf("unable to flush segments: %w", err))
+		}
+	}
+}
+
+// wakeupFlusher signals the flusher without blocking, a pending signal is sufficient if the flusher is busy
+func wakeupFlusher(db *Database) {
+	select {
+	case db.flusher <- true:
+	default:
+	}
+}
+
+// requestFlush wakes the flusher to write the immutable segments to disk. It is called when a full memory segment
+// is made immutable, or when there are too many immutable segments, but not for every snapshot, so that small
+// memory segments are written to disk together.
+func requestFlush(db *Database) {
+	atomic.StoreInt32(&db.flushRequested, 1)
+	wakeupFlusher(db)
+}
+
+// flushSegments0 writes the immutable segments that are held in memory to disk, oldest first, and replaces them
+// in the database state with the disk segments
+func flushSegments0(db *Database) error {
+	db.flushMu.Lock()
+	defer db.flushMu.Unlock()
+
+	for {
+		if atomic.LoadInt32(&db.closing) > 0 {
+			return nil
+		}
+		run := nextSegmentsToFlush(db.getState().segments)
+		if run == nil {
+			return nil
+		}
+		ds, err := writeSegmentToDisk(db, run)
+		if err != nil {
+			return err
+		}
+
+		db.Lock() // need lock when updating db segments
+		segments := replaceSegments(db.state.segments, run, ds)
+		db.setState(&dbState{segments: segments, memory: db.state.memory, multi: newMultiSegment(copyAndAppend(segments, db.state.memory))})
+		db.flushed.Broadcast()
+		db.Unlock()
+	}
+}
+
+// nextSegmentsToFlush returns the oldest run of consecutive segments that are not disk segments, or nil if there
+// is none. The run is written to disk as a single segment.
+func nextSegmentsToFlush(segments []segment) []segment {
+	for i, s := range segments {
+		if isDiskSegment(s) {
+			continue
+		}
+		j := i + 1
+		for j < len(segments) && !isDiskSegment(segments[j]) {
+			j++
+		}
+		return segments[i:j]
+	}
+	return nil
+}
+
+// replaceSegments returns a copy of segments with the run replaced by ds, or removed if ds is nil
+func replaceSegments(segments []segment, run []segment, ds segment) []segment {
+	replaced := make([]segment, 0, len(segments))
+	for _, s := range segments {
+		if s == run[0] {
+			if ds != nil {
+				replaced = append(replaced, ds)
+			}
+		} else if !containsSegment(run, s) {
+			replaced = append(replaced, s)
+		}
+	}
+	return replaced
+}
+
+func containsSegment(segments []segment, s segment) bool {
+	for _, s0 := range segments {
+		if s0 == s {
+			return true
+		}
+	}
+	return false
+}
+
+// unflushedSegments returns the number of immutable segments waiting to be written to disk
+func unflushedSegments(segments []segment) int {
+	n := 0
+	for _, s := range segments {
+		if !isDiskSegment(s) {
+			n++
+		}
+	}
+	return n
+}
+
+func isDiskSegment(s segment) bool {
+	_, ok := s.(*diskSegment)
+	return ok
+}
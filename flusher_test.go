@@ -0,0 +1,134 @@
+package leveldb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForFlush waits until all immutable segments of the database have been written to disk
+func waitForFlush(t *testing.T, db *Database) {
+	for i := 0; unflushedSegments(db.getState().segments) > 0; i++ {
+		if i == 1000 {
+			t.Fatal("segments were not flushed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFlusher(t *testing.T) {
+	options := Options{CreateIfNeeded: true, DisableAutoMerge: true, MaxImmutableMemtables: 2, FileSystem: NewMemFileSystem()}
+
+	db, err := Open("test/flushdb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	for i := 0; i < 100000; i++ {
+		err = db.Put([]byte(fmt.Sprint("mykey", i)), []byte(fmt.Sprint("myvalue", i)))
+		if err != nil {
+			t.Fatal("unable to put key/value", err)
+		}
+		if n := unflushedSegments(db.getState().segments); n > options.MaxImmutableMemtables {
+			t.Fatal("too many immutable segments", n)
+		}
+	}
+	waitForFlush(t, db)
+
+	if len(db.getState().segments) == 0 {
+		t.Fatal("memory segments should have been written to disk")
+	}
+	for i := 0; i < 100000; i += 1000 {
+		value, err := db.Get([]byte(fmt.Sprint("mykey", i)))
+		if err != nil || string(value) != fmt.Sprint("myvalue", i) {
+			t.Fatal("incorrect value", string(value), err)
+		}
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+}
+
+func TestFlusher_LogSegments(t *testing.T) {
+	ffs := newFaultFileSystem()
+	options := Options{CreateIfNeeded: true, DisableAutoMerge: true, FileSystem: ffs}
+
+	db, err := Open("test/flushdb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	for i := 0; i < 1000; i++ {
+		err = db.Put([]byte(fmt.Sprint("mykey", i)), []byte(fmt.Sprint("myvalue", i)))
+		if err != nil {
+			t.Fatal("unable to put key/value", err)
+		}
+	}
+	// kill the process, so the entries are only in the log
+	options.FileSystem = ffs.crash(false)
+
+	db, err = Open("test/flushdb", options)
+	if err != nil {
+		t.Fatal("unable to open database", err)
+	}
+	waitForFlush(t, db)
+
+	names, err := options.FileSystem.List("test/flushdb")
+	if err != nil {
+		t.Fatal("unable to list database", err)
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, "log.") {
+			t.Fatal("log file should have been removed", name)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		value, err := db.Get([]byte(fmt.Sprint("mykey", i)))
+		if err != nil || string(value) != fmt.Sprint("myvalue", i) {
+			t.Fatal("incorrect value", string(value), err)
+		}
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+}
+
+func TestFlusher_Snapshots(t *testing.T) {
+	options := Options{CreateIfNeeded: true, DisableAutoMerge: true, MaxImmutableMemtables: 4, FileSystem: NewMemFileSystem()}
+
+	db, err := Open("test/flushdb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	// every lookup makes the memory segment immutable, but they are written to disk together
+	for i := 0; i < 100; i++ {
+		err = db.Put([]byte(fmt.Sprint("mykey", i)), []byte(fmt.Sprint("myvalue", i)))
+		if err != nil {
+			t.Fatal("unable to put key/value", err)
+		}
+		_, err = db.Lookup(nil, nil)
+		if err != nil {
+			t.Fatal("unable to lookup", err)
+		}
+	}
+	err = db.flushMemory()
+	if err != nil {
+		t.Fatal("unable to flush memory", err)
+	}
+	waitForFlush(t, db)
+
+	if flushes := db.Stats().Flushes; flushes > uint64(100/options.MaxImmutableMemtables+1) {
+		t.Fatal("too many flushes", flushes)
+	}
+	for i := 0; i < 100; i++ {
+		value, err := db.Get([]byte(fmt.Sprint("mykey", i)))
+		if err != nil || string(value) != fmt.Sprint("myvalue", i) {
+			t.Fatal("incorrect value", string(value), err)
+		}
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/robaho/leveldb
 
-go 1.19
+go 1.21
 
 require (
 	github.com/nightlyone/lockfile v1.0.0
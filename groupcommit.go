@@ -0,0 +1,128 @@
+package leveldb
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// maximum number of key and value bytes committed by a single group
+const maxGroupCommitBytes = 1024 * 1024
+
+// writer is a queued Put, Remove or Write waiting to be committed. Concurrent writers are coalesced so that a
+// single leader appends all of their entries to the log with a single flush or sync, and then each writer applies
+// its own entries to the memory segment concurrently.
+type writer struct {
+	entries []KeyValue
+	// true if the entries were written using a WriteBatch, and must be applied atomically
+	batch bool
+	// true for a Remove, which reads the previous value of the key before the removal is logged
+	remove  bool
+	value   []byte
+	options WriteOptions
+	err     error
+	done    bool
+	cond    *sync.Cond
+	// the memory segment and sequence assigned by the leader, used to apply the entries
+	memory *memorySegment
+	seq    uint64
+}
+
+func (w *writer) size() int {
+	size := 0
+	for _, kv := range w.entries {
+		size += len(kv.key) + len(kv.value)
+	}
+	return size
+}
+
+// commit queues the writer and waits until its entries are logged, and then applies them. The writer at the front
+// of the queue becomes the leader, and logs the entries of the following writers as well.
+func (db *Database) commit(w *writer) error {
+	w.cond = sync.NewCond(&db.writersMu)
+
+	db.writersMu.Lock()
+	db.writers = append(db.writers, w)
+	for !w.done && db.writers[0] != w {
+		w.cond.Wait()
+	}
+	if !w.done {
+		group := []*writer{w}
+		size := w.size()
+		for _, next := range db.writers[1:] {
+			size += next.size()
+			// a Remove must lead its own group, so that it reads the previous value after the writers ahead of it
+			// have been applied
+			if size > maxGroupCommitBytes || w.remove || next.remove {
+				break
+			}
+			group = append(group, next)
+		}
+		db.writersMu.Unlock()
+
+		var err error
+		if w.remove {
+			w.value, err = db.previousValue(w.entries[0].key)
+		}
+		if err == nil {
+			err = db.logGroup(group)
+		}
+
+		db.writersMu.Lock()
+		for _, g := range group {
+			g.err = err
+			g.done = true
+			if g != w {
+				g.cond.Signal()
+			}
+		}
+		db.writers = db.writers[len(group):]
+		if len(db.writers) > 0 {
+			// wake up the next leader
+			db.writers[0].cond.Signal()
+		}
+	}
+	db.writersMu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	w.memory.apply(w)
+	atomic.AddUint64(&db.stats.bytesWritten, uint64(w.size()))
+
+	if wbm := db.getOptions().WriteBufferManager; wbm != nil {
+		wbm.maybeFlush(db)
+	}
+	db.maybeMerge()
+	return nil
+}
+
+// logGroup appends the entries of the group to the log of the current memory segment, and assigns the memory
+// segment and sequence each writer uses to apply its entries
+func (db *Database) logGroup(group []*writer) error {
+	db.Lock()
+	defer db.Unlock()
+
+	if !db.open {
+		return DatabaseClosed
+	}
+
+	err := db.maybeSwapMemory()
+	if err != nil {
+		return err
+	}
+
+	memory := db.state.memory
+	logged := memory.logBytes()
+	err = memory.logGroup(group)
+	if err != nil {
+		return err
+	}
+	atomic.AddUint64(&db.stats.walBytesWritten, memory.logBytes()-logged)
+	memory.writers.Add(len(group))
+	for _, w := range group {
+		db.seq++
+		w.seq = db.seq
+		w.memory = memory
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package leveldb
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupCommit(t *testing.T) {
+	ffs := newFaultFileSystem()
+	var syncs int32
+	ffs.fail = func(op, name string) error {
+		if op == "sync" {
+			atomic.AddInt32(&syncs, 1)
+			// simulate the latency of a disk sync, so that concurrent writers queue behind the leader
+			time.Sleep(100 * time.Microsecond)
+		}
+		return nil
+	}
+	options := Options{CreateIfNeeded: true, DisableAutoMerge: true, EnableSyncWrite: true, FileSystem: ffs}
+
+	db, err := Open("test/groupdb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+
+	nwriters, nrecs := 16, 500
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, nwriters)
+	for i := 0; i < nwriters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < nrecs; j++ {
+				var err error
+				if j%10 == 0 {
+					wb := WriteBatch{}
+					wb.Put([]byte(fmt.Sprint("batch", i, ".", j, ".1")), []byte("batchvalue1"))
+					wb.Put([]byte(fmt.Sprint("batch", i, ".", j, ".2")), []byte("batchvalue2"))
+					err = db.Write(wb)
+				} else {
+					err = db.Put([]byte(fmt.Sprint("mykey", i, ".", j)), []byte(fmt.Sprint("myvalue", j)))
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal("unable to write", err)
+	}
+
+	if n := atomic.LoadInt32(&syncs); n >= int32(nwriters*nrecs) {
+		t.Fatal("writes were not grouped, syncs", n)
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+
+	db, err = Open("test/groupdb", options)
+	if err != nil {
+		t.Fatal("unable to open database", err)
+	}
+	for i := 0; i < nwriters; i++ {
+		for j := 0; j < nrecs; j++ {
+			if j%10 == 0 {
+				value, err := db.Get([]byte(fmt.Sprint("batch", i, ".", j, ".2")))
+				if err != nil || string(value) != "batchvalue2" {
+					t.Fatal("incorrect value", i, j, string(value), err)
+				}
+				continue
+			}
+			value, err := db.Get([]byte(fmt.Sprint("mykey", i, ".", j)))
+			if err != nil || string(value) != fmt.Sprint("myvalue", j) {
+				t.Fatal("incorrect value", i, j, string(value), err)
+			}
+		}
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+}
+
+// TestConcurrentWriters verifies that concurrent updates of the same keys are applied to the memory segment in
+// the order they were logged, so the values are unchanged when the log is replayed after a crash
+func TestConcurrentWriters(t *testing.T) {
+	ffs := newFaultFileSystem()
+	options := Options{CreateIfNeeded: true, DisableAutoMerge: true, MaxMemoryBytes: 64 * 1024, FileSystem: ffs}
+
+	db, err := Open("test/concurrentdb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+
+	nwriters, nrecs, nkeys := 16, 5000, 4
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, nwriters)
+	for i := 0; i < nwriters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < nrecs; j++ {
+				key := []byte(fmt.Sprint("mykey", (i+j)%nkeys))
+				var err error
+				switch j % 10 {
+				case 0:
+					_, err = db.Remove(key)
+					if err == KeyNotFound {
+						err = nil
+					}
+				case 1:
+					wb := WriteBatch{}
+					wb.Put(key, []byte(fmt.Sprint("batchvalue", i, ".", j)))
+					wb.Put([]byte(fmt.Sprint("mykey", (i+j+1)%nkeys)), []byte(fmt.Sprint("batchvalue", i, ".", j)))
+					err = db.Write(wb)
+				default:
+					err = db.Put(key, []byte(fmt.Sprint("myvalue", i, ".", j)))
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal("unable to write", err)
+	}
+
+	expected := make(map[string]string)
+	for k := 0; k < nkeys; k++ {
+		key := fmt.Sprint("mykey", k)
+		value, err := db.Get([]byte(key))
+		if err != nil && err != KeyNotFound {
+			t.Fatal("unable to get key", err)
+		}
+		expected[key] = string(value)
+	}
+
+	options.FileSystem = ffs.crash(false)
+	db, err = Open("test/concurrentdb", options)
+	if err != nil {
+		t.Fatal("unable to open database", err)
+	}
+	for key, expect := range expected {
+		value, err := db.Get([]byte(key))
+		if err != nil && err != KeyNotFound {
+			t.Fatal("unable to get key", err)
+		}
+		if string(value) != expect {
+			t.Fatal("incorrect value after recovery", key, string(value), expect)
+		}
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+}
+
+func TestConcurrentRemove(t *testing.T) {
+	db, err := Open("test/concurrentremove", Options{CreateIfNeeded: true, DisableAutoMerge: true, FileSystem: NewMemFileSystem()})
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+
+	nwriters, nrecs := 8, 1000
+	key := []byte("mykey")
+
+	// every value is returned by at most one Remove, as the lookup is atomic with the removal
+	var mu sync.Mutex
+	removed := make(map[string]bool)
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, 2*nwriters)
+	for i := 0; i < nwriters; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < nrecs; j++ {
+				if err := db.Put(key, []byte(fmt.Sprint("myvalue", i, ".", j))); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < nrecs; j++ {
+				value, err := db.Remove(key)
+				if err == KeyNotFound {
+					continue
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+				mu.Lock()
+				duplicate := removed[string(value)]
+				removed[string(value)] = true
+				mu.Unlock()
+				if duplicate {
+					errs <- fmt.Errorf("value %s removed twice", value)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal("unable to write", err)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+}
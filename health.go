@@ -0,0 +1,78 @@
+package leveldb
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Health describes the state of the background flushing and merging of a database
+type Health struct {
+	// the error of the failed flush or merge, or nil if the database is healthy
+	Err error
+	// when the error occurred
+	ErrTime time.Time
+	// number of memory and log segments waiting to be written to disk
+	UnflushedSegments int
+	// number of disk segments, which the merger reduces to Options.MaxSegments
+	DiskSegments int
+}
+
+// Err returns the error of a failed background flush or merge, or nil. Once a background error has occurred,
+// writes fail with an error wrapping BackgroundError and the error, until Resume() succeeds. Reads continue to work.
+func (db *Database) Err() error {
+	db.Lock()
+	defer db.Unlock()
+	return db.err
+}
+
+// Health returns the background error, if any, and the backlog of the flusher and merger
+func (db *Database) Health() Health {
+	db.Lock()
+	health := Health{Err: db.err, ErrTime: db.errTime}
+	db.Unlock()
+
+	segments := db.getState().segments
+	health.UnflushedSegments = unflushedSegments(segments)
+	health.DiskSegments = len(segments) - health.UnflushedSegments
+	return health
+}
+
+// Resume clears the background error after its cause has been fixed, e.g. disk space has been freed, and retries
+// the failed work. It returns nil if the database is healthy, or the new background error if the retry fails.
+func (db *Database) Resume() error {
+	db.Lock()
+	if !db.open || atomic.LoadInt32(&db.closing) > 0 {
+		db.Unlock()
+		return DatabaseClosed
+	}
+	if db.err == nil {
+		db.Unlock()
+		return nil
+	}
+	db.logger().Info("resuming after background error", "error", db.err)
+	db.err = nil
+	db.errTime = time.Time{}
+	atomic.StoreInt32(&db.failed, 0)
+	db.Unlock()
+
+	err := flushSegments0(db)
+	if err != nil {
+		err = fmt.Errorf("unable to flush segments: %w", err)
+	} else if options := db.getOptions(); !options.DisableAutoMerge {
+		err = mergeSegments0(db, options.MaxSegments, false)
+		if err != nil {
+			err = fmt.Errorf("unable to merge segments: %w", err)
+		}
+	}
+	if err != nil {
+		db.backgroundError(err)
+		return db.backgroundFailure(err)
+	}
+	return nil
+}
+
+// backgroundFailure returns the error for a write to a database with the background error err
+func (db *Database) backgroundFailure(err error) error {
+	return &Error{Code: BackgroundErrorCode, Path: db.path, Err: err}
+}
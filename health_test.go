@@ -0,0 +1,99 @@
+package leveldb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResume(t *testing.T) {
+	ffs := newFaultFileSystem()
+	options := Options{CreateIfNeeded: true, DisableAutoMerge: true, FileSystem: ffs}
+
+	db, err := Open("test/healthdb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	if db.Err() != nil || db.Health().Err != nil {
+		t.Fatal("database should be healthy", db.Health())
+	}
+	err = db.Put([]byte("mykey"), []byte("myvalue"))
+	if err != nil {
+		t.Fatal("unable to put key/value", err)
+	}
+	injected := errors.New("disk full")
+	ffs.fail = func(op, name string) error {
+		if op == "create" && strings.Contains(name, "keys.") {
+			return injected
+		}
+		return nil
+	}
+	err = db.flushMemory()
+	if err != nil {
+		t.Fatal("unable to flush memory", err)
+	}
+	for i := 0; db.Err() == nil; i++ {
+		if i == 1000 {
+			t.Fatal("background error was not reported")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !errors.Is(db.Err(), injected) {
+		t.Fatal("background error should wrap the cause", db.Err())
+	}
+	health := db.Health()
+	if health.Err == nil || health.ErrTime.IsZero() || health.UnflushedSegments != 1 {
+		t.Fatal("incorrect health", health)
+	}
+
+	err = db.Put([]byte("mykey2"), []byte("myvalue2"))
+	if !errors.Is(err, BackgroundError) || !errors.Is(err, injected) {
+		t.Fatal("put should fail with the background error", err)
+	}
+	value, err := db.Get([]byte("mykey"))
+	if err != nil || string(value) != "myvalue" {
+		t.Fatal("reads should continue to work", err)
+	}
+
+	// the cause has not been fixed
+	err = db.Resume()
+	if !errors.Is(err, BackgroundError) || !errors.Is(db.Err(), injected) {
+		t.Fatal("resume should fail", err)
+	}
+
+	ffs.mu.Lock()
+	ffs.fail = nil
+	ffs.mu.Unlock()
+	err = db.Resume()
+	if err != nil {
+		t.Fatal("unable to resume", err)
+	}
+	health = db.Health()
+	if health.Err != nil || health.UnflushedSegments != 0 || health.DiskSegments != 1 {
+		t.Fatal("incorrect health after resume", health)
+	}
+	err = db.Put([]byte("mykey2"), []byte("myvalue2"))
+	if err != nil {
+		t.Fatal("unable to put key/value after resume", err)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+
+	db, err = Open("test/healthdb", options)
+	if err != nil {
+		t.Fatal("unable to open database", err)
+	}
+	defer db.Close()
+	for _, key := range []string{"mykey", "mykey2"} {
+		_, err = db.Get([]byte(key))
+		if err != nil {
+			t.Fatal("key should exist", key, err)
+		}
+	}
+	if db.Resume() != nil {
+		t.Fatal("resume of a healthy database should succeed")
+	}
+}
@@ -5,9 +5,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"github.com/robaho/leveldb/skip"
 	"io"
-	"os"
 	"path/filepath"
 )
 
@@ -17,41 +15,92 @@ import (
 //	EndBatchMarker is { negative int32 length of batch which matches StartBatchMarker }
 //	LogEntry is { int32 key len, key bytes, int32 value len, value bytes }
 type logFile struct {
-	file         *os.File
+	fs           FileSystem
+	file         WritableFile
+	name         string
 	w            *bufio.Writer
 	id           uint64
 	inBatch      bool
+	inGroup      bool
 	disableFlush bool
+	sync         bool
+	// true once the directory entry for the log file has been synced
+	dirSynced bool
+	// number of bytes written
+	written uint64
 }
 
 func newLogFile(path string, id uint64, options Options) (*logFile, error) {
-	mode := os.O_TRUNC | os.O_WRONLY | os.O_CREATE
-	if options.EnableSyncWrite {
-		mode = mode | os.O_SYNC
-	}
-	f, err := os.OpenFile(filepath.Join(path, "log."+fmt.Sprint(id)), mode, 0644)
+	name := filepath.Join(path, "log."+fmt.Sprint(id))
+	f, err := options.fs().Create(name)
 	if err != nil {
 		return nil, err
 	}
-	l := logFile{file: f, id: id, w: bufio.NewWriter(f)}
+	l := logFile{fs: options.fs(), file: f, name: name, id: id, w: bufio.NewWriter(f), sync: options.EnableSyncWrite}
 	if !options.EnableSyncWrite && options.DisableWriteFlush {
 		l.disableFlush = true
 	}
 	return &l, nil
 }
+
+// flush writes any buffered data to the file, and syncs the file if sync writes are enabled
+func (f *logFile) flush() error {
+	err := f.w.Flush()
+	if err != nil {
+		return err
+	}
+	if f.sync {
+		return f.syncFile()
+	}
+	return nil
+}
+// syncFile syncs the file, and the first time, the directory, since the log file itself must survive a crash
+// for the synced writes to be durable
+func (f *logFile) syncFile() error {
+	if !f.dirSynced {
+		err := f.fs.SyncDir(filepath.Dir(f.name))
+		if err != nil {
+			return err
+		}
+		f.dirSynced = true
+	}
+	return f.file.Sync()
+}
+// StartGroup defers flushing until EndGroup, so that multiple writes and batches are committed together
+func (f *logFile) StartGroup() {
+	f.inGroup = true
+}
+// EndGroup writes the group to the file unless flushing is disabled, and syncs the file if sync is true
+func (f *logFile) EndGroup(sync bool) error {
+	f.inGroup = false
+	if f.disableFlush && !sync {
+		return nil
+	}
+	err := f.w.Flush()
+	if err != nil || !sync {
+		return err
+	}
+	return f.syncFile()
+}
 func (f *logFile) StartBatch(len int) error {
 	f.inBatch = true
+	f.written += 4
 	return binary.Write(f.w, binary.LittleEndian, int32(-len))
 }
 func (f *logFile) EndBatch(len int) error {
 	f.inBatch = false
+	f.written += 4
 	err := binary.Write(f.w, binary.LittleEndian, int32(-len))
 	if err != nil {
 		return err
 	}
-	return f.w.Flush()
+	if f.inGroup {
+		return nil
+	}
+	return f.flush()
 }
 func (f *logFile) Write(key []byte, value []byte) error {
+	f.written += uint64(8 + len(key) + len(value))
 	err := binary.Write(f.w, binary.LittleEndian, int32(len(key)))
 	if err != nil {
 		return err
@@ -68,8 +117,8 @@ func (f *logFile) Write(key []byte, value []byte) error {
 	if err != nil {
 		return err
 	}
-	if !f.inBatch && !f.disableFlush {
-		return f.w.Flush()
+	if !f.inBatch && !f.inGroup && !f.disableFlush {
+		return f.flush()
 	}
 	return nil
 }
@@ -80,7 +129,7 @@ func (f *logFile) Close() error {
 }
 
 func (f *logFile) Remove() error {
-	return os.Remove(f.file.Name())
+	return f.fs.Remove(f.name)
 }
 
 func keyValueCompare(options Options) func(a, b KeyValue) int {
@@ -95,18 +144,64 @@ func keyValueCompare(options Options) func(a, b KeyValue) int {
 	}
 }
 
-func readLogFile(path string, options Options) (*skip.SkipList[KeyValue], error) {
-	f, err := os.OpenFile(path, os.O_RDONLY, 0)
+// countingReader counts the bytes read, so that the offset of invalid data can be reported
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+func readLogFile(path string, options Options) (memtable, error) {
+	table := newMemtable(options)
+	_, err := readLogFile0(path, options, table, 0, false)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	return table, nil
+}
 
-	r := bufio.NewReader(f)
+// readLogFile0 reads the entries of the log file starting at offset into table, and returns the offset following
+// the last entry or batch read. If partialTail is true, the log file may be being written by another process, so an
+// incomplete entry or batch at the end of the file is ignored, and read by a later call starting at the returned
+// offset.
+func readLogFile0(path string, options Options, table memtable, start int64, partialTail bool) (int64, error) {
+	f, err := options.fs().Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
 
-	list := skip.NewSkipList(keyValueCompare(options))
+	size := int64(f.Len())
+	if start > size {
+		return 0, corruption(path, start, fmt.Errorf("log file truncated to %d bytes", size))
+	}
+	r := &countingReader{r: bufio.NewReader(io.NewSectionReader(f, start, size-start)), n: start}
+	fileLen := int32(size)
 
 	var len, kLen, vLen int32
+	// offset of the entry or batch being read
+	var offset int64
+	// set if an incomplete entry or batch is being written at the end of the file
+	var tail bool
+
+	atTail := func(err error) bool {
+		tail = partialTail && (err == io.EOF || err == io.ErrUnexpectedEOF)
+		return tail
+	}
+
+	// readLen reads a key or value length, which must fit in the remainder of the file
+	readLen := func(n *int32) error {
+		err := binary.Read(r, binary.LittleEndian, n)
+		if err == nil && (*n < 0 || *n > fileLen) {
+			err = fmt.Errorf("invalid length %d", *n)
+		}
+		return err
+	}
 
 	readBatch := func(len int32) error {
 		var err error
@@ -114,7 +209,7 @@ func readLogFile(path string, options Options) (*skip.SkipList[KeyValue], error)
 		entries := make([]KeyValue, 0)
 		// start of batch
 		for i := 0; i < int(len*-1); i++ {
-			err = binary.Read(r, binary.LittleEndian, &kLen)
+			err = readLen(&kLen)
 			if err != nil {
 				goto batchReadError
 			}
@@ -123,7 +218,7 @@ func readLogFile(path string, options Options) (*skip.SkipList[KeyValue], error)
 			if err != nil {
 				goto batchReadError
 			}
-			err = binary.Read(r, binary.LittleEndian, &vLen)
+			err = readLen(&vLen)
 			if err != nil {
 				goto batchReadError
 			}
@@ -140,52 +235,76 @@ func readLogFile(path string, options Options) (*skip.SkipList[KeyValue], error)
 			goto batchReadError
 		}
 		if len0 != len {
-			err = DatabaseCorrupted
+			err = fmt.Errorf("batch end marker %d does not match %d", len0, len)
 			goto batchReadError
 		}
 	batchReadError:
+		if atTail(err) {
+			// the batch has not been committed
+			return nil
+		}
+		if err != nil {
+			err = corruption(path, offset, err)
+			switch options.BatchReadMode {
+			case ApplyPartial:
+				options.logger().Warn("applied partial batch", "file", path, "batchSize", -len, "error", err)
+			case DiscardPartial:
+				options.logger().Warn("discarded partial batch", "file", path, "batchSize", -len, "error", err)
+			default:
+				options.logger().Error("partial batch", "file", path, "batchSize", -len, "error", err)
+			}
+		}
 		if options.BatchReadMode == ApplyPartial || err == nil {
 			for _, e := range entries {
-				list.Put(e)
+				table.put(e, 0)
 			}
 		}
 		return err
 	}
 
 	for {
+		offset = r.n
 		err := binary.Read(r, binary.LittleEndian, &len)
-		if err == io.EOF {
-			return &list, nil
+		if err == io.EOF || atTail(err) {
+			return offset, nil
 		}
 		if err != nil {
-			return nil, err
+			return 0, corruption(path, offset, err)
 		}
 		if len < 0 {
 			err = readBatch(len)
+			if tail {
+				return offset, nil
+			}
 			if err != nil {
 				if options.BatchReadMode == ReturnOpenError {
-					return nil, err
+					return 0, err
 				}
-				return &list, nil
+				return size, nil
 			}
 		} else {
 			kLen = len
+			if kLen > fileLen {
+				return 0, corruption(path, offset, fmt.Errorf("invalid length %d", kLen))
+			}
 			key := make([]byte, kLen)
 			err = binary.Read(r, binary.LittleEndian, &key)
-			if err != nil {
-				return nil, err
+			if err == nil {
+				err = readLen(&vLen)
 			}
-			err = binary.Read(r, binary.LittleEndian, &vLen)
-			if err != nil {
-				return nil, err
+			if err == nil {
+				value := make([]byte, vLen)
+				err = binary.Read(r, binary.LittleEndian, &value)
+				if err == nil {
+					table.put(KeyValue{key: key, value: value}, 0)
+					continue
+				}
 			}
-			value := make([]byte, vLen)
-			err = binary.Read(r, binary.LittleEndian, &value)
-			if err != nil {
-				return nil, err
+			if atTail(err) {
+				return offset, nil
 			}
-			list.Put(KeyValue{key: key, value: value})
+			return 0, corruption(path, offset, err)
 		}
 	}
-	return &list, nil
+	return 0, nil
 }
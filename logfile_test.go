@@ -3,7 +3,6 @@ package leveldb
 import (
 	"bytes"
 	"errors"
-	"github.com/robaho/leveldb/skip"
 	"os"
 	"testing"
 )
@@ -47,8 +46,8 @@ func writeLogFile() error {
 	return nil
 }
 
-func testKeyValue(s *skip.SkipList[KeyValue], key string, value string) error {
-	r, ok := s.Get(KeyValue{key: []byte(key)})
+func testKeyValue(s memtable, key string, value string) error {
+	r, ok := s.get([]byte(key))
 	if !ok {
 		return errors.New("key not found")
 	}
@@ -133,3 +132,66 @@ func TestLogFile_PartialBatch(t *testing.T) {
 		t.Fatal("batchkey2 should have been dropped")
 	}
 }
+
+func TestLogFile_PartialTail(t *testing.T) {
+	err := writeLogFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Truncate("test/log.0", 84-12) // truncate into batch
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the batch is still being written, so it is not applied
+	s := newMemtable(Options{})
+	offset, err := readLogFile0("test/log.0", Options{BatchReadMode: ApplyPartial}, s, 0, true)
+	if err != nil {
+		t.Fatal("file should have opened", err)
+	}
+	if offset != 20 {
+		t.Fatal("offset should be the start of the batch", offset)
+	}
+	if err = testKeyValue(s, "mykey", "myvalue"); err != nil {
+		t.Fatal(err)
+	}
+	if err = testKeyValue(s, "batchkey1", "batchvalue1"); err == nil {
+		t.Fatal("batchkey1 should not be applied")
+	}
+
+	// the completed batch is read from the offset
+	err = writeLogFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = newMemtable(Options{})
+	offset, err = readLogFile0("test/log.0", Options{}, s, offset, true)
+	if err != nil {
+		t.Fatal("file should have opened", err)
+	}
+	if offset != 84 {
+		t.Fatal("incorrect offset", offset)
+	}
+	if err = testKeyValue(s, "batchkey2", "batchvalue2"); err != nil {
+		t.Fatal(err)
+	}
+	if err = testKeyValue(s, "mykey", "myvalue"); err == nil {
+		t.Fatal("mykey should not be read again")
+	}
+
+	err = os.Truncate("test/log.0", 10) // truncate into entry
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = readLogFile("test/log.0", Options{})
+	if !errors.Is(err, DatabaseCorrupted) {
+		t.Fatal("file should have failed to load", err)
+	}
+	s = newMemtable(Options{})
+	_, err = readLogFile0("test/log.0", Options{}, s, 0, true)
+	if err != nil {
+		t.Fatal("file should have opened", err)
+	}
+	if err = testKeyValue(s, "mykey", "myvalue"); err == nil {
+		t.Fatal("mykey should not be applied")
+	}
+}
@@ -0,0 +1,34 @@
+package leveldb
+
+import (
+	"context"
+	"log/slog"
+)
+
+// discardHandler is the slog.Handler used when Options.Logger is not set
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+var discardLogger = slog.New(discardHandler{})
+
+// logger returns the configured Logger or one that discards all records
+func (options Options) logger() *slog.Logger {
+	if options.Logger == nil {
+		return discardLogger
+	}
+	return options.Logger
+}
+
+// logger returns the Logger of the database, which adds the path of the database to each record
+func (db *Database) logger() *slog.Logger {
+	return db.getOptions().logger().With("path", db.path)
+}
+
+// segmentAttr returns the id range of the segment as a log attribute
+func segmentAttr(key string, id SegmentID) slog.Attr {
+	return slog.Group(key, "lower", id.Lower, "upper", id.Upper)
+}
@@ -0,0 +1,70 @@
+package leveldb
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	options := Options{CreateIfNeeded: true, DisableAutoMerge: true, FileSystem: NewMemFileSystem(), Logger: logger}
+
+	db, err := Open("test/loggerdb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	for i := 0; i < 2; i++ {
+		err = db.Put([]byte(fmt.Sprint("mykey", i)), []byte("myvalue"))
+		if err != nil {
+			t.Fatal("unable to put key/value", err)
+		}
+		err = db.flushMemory()
+		if err != nil {
+			t.Fatal("unable to flush memory", err)
+		}
+		waitForFlush(t, db)
+	}
+	err = mergeSegments0(db, 1, false)
+	if err != nil {
+		t.Fatal("unable to merge", err)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+
+	out := buf.String()
+	for _, msg := range []string{"opened database", "flushed segment", "merged segments", "deleted segment files", "closed database"} {
+		if !strings.Contains(out, "msg=\""+msg+"\"") {
+			t.Fatal("missing log record", msg, out)
+		}
+	}
+	if !strings.Contains(out, "path=test/loggerdb") || !strings.Contains(out, "segment.lower=1 segment.upper=1") {
+		t.Fatal("missing log attributes", out)
+	}
+}
+
+func TestLogger_PartialBatch(t *testing.T) {
+	err := writeLogFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Truncate("test/log.0", 84-12) // truncate into batch
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	_, err = readLogFile("test/log.0", Options{BatchReadMode: DiscardPartial, Logger: logger})
+	if err != nil {
+		t.Fatal("file should have opened", err)
+	}
+	if out := buf.String(); !strings.Contains(out, "level=WARN msg=\"discarded partial batch\" file=test/log.0 batchSize=2") {
+		t.Fatal("missing log record", out)
+	}
+}
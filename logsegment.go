@@ -1,41 +1,66 @@
 package leveldb
 
 import (
-	"github.com/robaho/leveldb/skip"
-	"os"
 	"path/filepath"
 	"runtime"
 )
 
 // logSegment is a read-only segment created from a previous run but not yet merged
 type logSegment struct {
-	list     skip.SkipList[KeyValue]
+	table memtable
+	// the segment holding the entries before those in table, if the log file was read by tail
+	prev *logSegment
+	// number of segments chained by prev
+	depth    int
 	id       uint64
 	path     string
 	options  Options
 	filesize uint64
 }
 
-func newLogSegment(path string, options Options) (segment, error) {
+// maximum number of segments chained by tail, before the log file is replayed from the start
+const maxLogTailDepth = 8
+
+// newLogSegment replays the log file, see readLogFile0 for partialTail
+func newLogSegment(path string, options Options, partialTail bool) (*logSegment, error) {
 	ls := new(logSegment)
 
-	list, err := readLogFile(path, options)
+	id, err := getSegmentID(path)
 	if err != nil {
 		return nil, err
 	}
-	ls.list = *list
-	ls.id = getSegmentID(path)
-	ls.path = path
-	ls.options = options
-	info, err := os.Stat(path)
+	table := newMemtable(options)
+	offset, err := readLogFile0(path, options, table, 0, partialTail)
 	if err != nil {
 		return nil, err
 	}
-	ls.filesize = uint64(info.Size())
+	ls.table = table
+	ls.id = id
+	ls.path = path
+	ls.options = options
+	ls.filesize = uint64(offset)
 
 	return ls, nil
 }
 
+// tail returns a segment that includes the entries appended to the log file by another process since ls was read.
+// Only the new entries are read, into a memtable layered over ls, so the snapshots that reference ls are not
+// affected. ls is returned if there are no new complete entries.
+func (ls *logSegment) tail() (*logSegment, error) {
+	if ls.depth == maxLogTailDepth {
+		return newLogSegment(ls.path, ls.options, true)
+	}
+	table := newMemtable(ls.options)
+	offset, err := readLogFile0(ls.path, ls.options, table, int64(ls.filesize), true)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(offset) == ls.filesize {
+		return ls, nil
+	}
+	return &logSegment{table: table, prev: ls, depth: ls.depth + 1, id: ls.id, path: ls.path, options: ls.options, filesize: uint64(offset)}, nil
+}
+
 func (ls *logSegment) size() uint64 {
 	return ls.filesize
 }
@@ -48,31 +73,58 @@ func (ls *logSegment) UpperID() uint64 {
 }
 
 func (ls *logSegment) Get(key []byte) ([]byte, error) {
-	value, ok := ls.list.Get(Key(key))
+	value, ok := ls.table.get(key)
 	if !ok {
+		if ls.prev != nil {
+			return ls.prev.Get(key)
+		}
 		return nil, KeyNotFound
 	}
 	return value.value, nil
 }
 
-func (ls *logSegment) Put(key []byte, value []byte) ([]byte, error) {
-	panic("Put called on immutable logSegment")
+func (ls *logSegment) Put(key []byte, value []byte) error {
+	return ReadOnlySegment
 }
 func (ls *logSegment) Write(wb WriteBatch) error {
-	panic("Write called on immutable logSegment")
+	return ReadOnlySegment
 }
-func (ls *logSegment) Remove(key []byte) ([]byte, error) {
-	panic("Remove called on immutable logSegment")
+func (ls *logSegment) Remove(key []byte) error {
+	return ReadOnlySegment
 }
 
 func (ls *logSegment) Lookup(lower []byte, upper []byte) (LookupIterator, error) {
-	itr := ls.list.Iterator()
+	itr := ls.table.iterator()
 	if lower != nil {
 		itr.Seek(Key(lower))
 	} else {
 		itr.SeekToFirst()
 	}
-	return &skiplistIterator{itr: itr, lower: Key(lower), upper: Key(upper), cmp: keyValueCompare(ls.options)}, nil
+	current := &skiplistIterator{itr: itr, lower: Key(lower), upper: Key(upper), cmp: keyValueCompare(ls.options)}
+	if ls.prev == nil {
+		return current, nil
+	}
+	prev, err := ls.prev.Lookup(lower, upper)
+	if err != nil {
+		return nil, err
+	}
+	// the newer entries are last
+	return &multiSegmentIterator{iterators: []LookupIterator{prev, current}}, nil
+}
+
+// LookupKeys is the same as Lookup since the values are already in memory
+func (ls *logSegment) LookupKeys(lower []byte, upper []byte) (LookupIterator, error) {
+	return ls.Lookup(lower, upper)
+}
+
+// GetUnsafe is the same as Get since the values are already in memory
+func (ls *logSegment) GetUnsafe(key []byte) ([]byte, error) {
+	return ls.Get(key)
+}
+
+// LookupUnsafe is the same as Lookup since the values are already in memory
+func (ls *logSegment) LookupUnsafe(lower []byte, upper []byte) (LookupIterator, error) {
+	return ls.Lookup(lower, upper)
 }
 
 func (ls *logSegment) Close() error {
@@ -82,12 +134,12 @@ func (ls *logSegment) Close() error {
 func (ls *logSegment) removeSegment() error {
 	var err0, err1 error
 	err0 = ls.Close()
-	err1 = os.Remove(ls.path)
+	err1 = ls.options.fs().Remove(ls.path)
 	return errn(err0, err1)
 }
 
-func (ls *logSegment) removeOnFinalize() {
-	runtime.SetFinalizer(ls, func(ls *logSegment) { ls.removeSegment() })
+func (ls *logSegment) removeOnFinalize(remove func(s segment)) {
+	runtime.SetFinalizer(ls, func(ls *logSegment) { remove(ls) })
 }
 
 func (ls *logSegment) files() []string {
@@ -0,0 +1,291 @@
+package leveldb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memFileSystem is a FileSystem that holds all files in memory. Files that are open for reading are not
+// affected by subsequent writes, renames or removes.
+type memFileSystem struct {
+	mu    sync.Mutex
+	files map[string]*memFile
+	dirs  map[string]bool
+	locks map[string]bool
+}
+
+type memFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemFileSystem returns a FileSystem that never touches the disk. The contents are lost when the
+// FileSystem is no longer referenced. The same instance must be passed to Open to reopen a database.
+func NewMemFileSystem() FileSystem {
+	return &memFileSystem{files: make(map[string]*memFile), dirs: make(map[string]bool), locks: make(map[string]bool)}
+}
+
+func (mfs *memFileSystem) mkdirs(dir string) {
+	for {
+		mfs.dirs[dir] = true
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
+	}
+}
+
+func (mfs *memFileSystem) create(name string, truncate bool) (WritableFile, error) {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if mfs.dirs[name] {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+	if !mfs.dirs[filepath.Dir(name)] {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	f, ok := mfs.files[name]
+	if !ok || truncate {
+		f = &memFile{modTime: time.Now()}
+		mfs.files[name] = f
+	}
+	return &memWritableFile{fs: mfs, file: f}, nil
+}
+
+func (mfs *memFileSystem) Create(name string) (WritableFile, error) {
+	return mfs.create(name, true)
+}
+
+func (mfs *memFileSystem) Append(name string) (WritableFile, error) {
+	return mfs.create(name, false)
+}
+
+func (mfs *memFileSystem) Open(name string) (RandomAccessFile, error) {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	name = filepath.Clean(name)
+	f, ok := mfs.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return &memRandomAccessFile{data: f.data}, nil
+}
+
+func (mfs *memFileSystem) Rename(oldname, newname string) error {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	oldname, newname = filepath.Clean(oldname), filepath.Clean(newname)
+	f, ok := mfs.files[oldname]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	delete(mfs.files, oldname)
+	mfs.files[newname] = f
+	return nil
+}
+
+func (mfs *memFileSystem) Remove(name string) error {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if _, ok := mfs.files[name]; ok {
+		delete(mfs.files, name)
+		return nil
+	}
+	if mfs.dirs[name] {
+		prefix := name + string(filepath.Separator)
+		for path := range mfs.files {
+			if strings.HasPrefix(path, prefix) {
+				return &os.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+			}
+		}
+		delete(mfs.dirs, name)
+		return nil
+	}
+	return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+}
+
+func (mfs *memFileSystem) RemoveAll(path string) error {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	path = filepath.Clean(path)
+	prefix := path + string(filepath.Separator)
+	for name := range mfs.files {
+		if name == path || strings.HasPrefix(name, prefix) {
+			delete(mfs.files, name)
+		}
+	}
+	for name := range mfs.dirs {
+		if name == path || strings.HasPrefix(name, prefix) {
+			delete(mfs.dirs, name)
+		}
+	}
+	return nil
+}
+
+func (mfs *memFileSystem) MkdirAll(path string) error {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	path = filepath.Clean(path)
+	if _, ok := mfs.files[path]; ok {
+		return &os.PathError{Op: "mkdir", Path: path, Err: errors.New("not a directory")}
+	}
+	mfs.mkdirs(path)
+	return nil
+}
+
+func (mfs *memFileSystem) List(dir string) ([]string, error) {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	dir = filepath.Clean(dir)
+	if !mfs.dirs[dir] {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: os.ErrNotExist}
+	}
+	names := make([]string, 0)
+	for name := range mfs.files {
+		if filepath.Dir(name) == dir {
+			names = append(names, filepath.Base(name))
+		}
+	}
+	for name := range mfs.dirs {
+		if name != dir && filepath.Dir(name) == dir {
+			names = append(names, filepath.Base(name))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (mfs *memFileSystem) SyncDir(dir string) error {
+	return nil
+}
+
+func (mfs *memFileSystem) Stat(name string) (fs.FileInfo, error) {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if f, ok := mfs.files[name]; ok {
+		return &memFileInfo{name: filepath.Base(name), size: int64(len(f.data)), modTime: f.modTime}, nil
+	}
+	if mfs.dirs[name] {
+		return &memFileInfo{name: filepath.Base(name), dir: true}, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+type memLock struct {
+	fs   *memFileSystem
+	name string
+}
+
+func (l *memLock) Close() error {
+	l.fs.mu.Lock()
+	defer l.fs.mu.Unlock()
+	delete(l.fs.locks, l.name)
+	return nil
+}
+
+func (mfs *memFileSystem) Lock(name string) (io.Closer, error) {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if mfs.locks[name] {
+		return nil, fmt.Errorf("%s is locked", name)
+	}
+	mfs.locks[name] = true
+	return &memLock{fs: mfs, name: name}, nil
+}
+
+type memWritableFile struct {
+	fs   *memFileSystem
+	file *memFile
+}
+
+func (f *memWritableFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	f.file.data = append(f.file.data, p...)
+	f.file.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memWritableFile) Sync() error {
+	return nil
+}
+
+func (f *memWritableFile) Close() error {
+	return nil
+}
+
+// memRandomAccessFile reads the file contents at the time it was opened
+type memRandomAccessFile struct {
+	data []byte
+}
+
+func (f *memRandomAccessFile) ReadAt(buffer []byte, off int64) (int, error) {
+	if off < 0 || int64(len(f.data)) < off {
+		return 0, fmt.Errorf("invalid ReadAt offset %d", off)
+	}
+	n := copy(buffer, f.data[off:])
+	if n < len(buffer) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memRandomAccessFile) Len() int {
+	return len(f.data)
+}
+
+func (f *memRandomAccessFile) Slice(off int64, length int) ([]byte, error) {
+	if off < 0 || length < 0 || int64(len(f.data)) < off+int64(length) {
+		return nil, fmt.Errorf("invalid Slice offset %d length %d", off, length)
+	}
+	return f.data[off : off+int64(length) : off+int64(length)], nil
+}
+
+func (f *memRandomAccessFile) contents() []byte {
+	return f.data
+}
+
+func (f *memRandomAccessFile) Close() error {
+	return nil
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memFileInfo) IsDir() bool        { return fi.dir }
+func (fi *memFileInfo) Sys() any           { return nil }
+func (fi *memFileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
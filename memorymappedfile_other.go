@@ -0,0 +1,27 @@
+//go:build !(linux || darwin)
+
+package leveldb
+
+import "golang.org/x/exp/mmap"
+
+// otherMappedFile uses the portable mmap package, which does not expose the mapping, so slices are copies
+type otherMappedFile struct {
+	*mmap.ReaderAt
+}
+
+func openMappedFile(filename string) (RandomAccessFile, error) {
+	file, err := mmap.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &otherMappedFile{ReaderAt: file}, nil
+}
+
+func (mf *otherMappedFile) Slice(off int64, length int) ([]byte, error) {
+	buffer := make([]byte, length)
+	_, err := mf.ReadAt(buffer, off)
+	if err != nil {
+		return nil, err
+	}
+	return buffer, nil
+}
@@ -0,0 +1,87 @@
+//go:build linux || darwin
+
+package leveldb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// unixMappedFile maps the file directly so that slices of the mapping can be returned without copying
+type unixMappedFile struct {
+	data []byte
+}
+
+func openMappedFile(filename string) (RandomAccessFile, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	size := fi.Size()
+	if size == 0 {
+		return &unixMappedFile{}, nil
+	}
+	if size != int64(int(size)) {
+		return nil, fmt.Errorf("mmap: file %q is too large", filename)
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	mf := &unixMappedFile{data: data}
+	runtime.SetFinalizer(mf, (*unixMappedFile).Close)
+	return mf, nil
+}
+
+func (mf *unixMappedFile) Len() int {
+	return len(mf.data)
+}
+
+func (mf *unixMappedFile) ReadAt(buffer []byte, off int64) (int, error) {
+	if mf.data == nil {
+		return 0, errors.New("mmap: closed")
+	}
+	if off < 0 || int64(len(mf.data)) < off {
+		return 0, fmt.Errorf("mmap: invalid ReadAt offset %d", off)
+	}
+	n := copy(buffer, mf.data[off:])
+	if n < len(buffer) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (mf *unixMappedFile) Slice(off int64, length int) ([]byte, error) {
+	if mf.data == nil {
+		return nil, errors.New("mmap: closed")
+	}
+	if off < 0 || length < 0 || int64(len(mf.data)) < off+int64(length) {
+		return nil, fmt.Errorf("mmap: invalid Slice offset %d length %d", off, length)
+	}
+	return mf.data[off : off+int64(length) : off+int64(length)], nil
+}
+
+func (mf *unixMappedFile) contents() []byte {
+	return mf.data
+}
+
+func (mf *unixMappedFile) Close() error {
+	if mf.data == nil {
+		return nil
+	}
+	data := mf.data
+	mf.data = nil
+	runtime.SetFinalizer(mf, nil)
+	return syscall.Munmap(data)
+}
@@ -1,25 +1,26 @@
 package leveldb
 
 import (
-	"github.com/robaho/leveldb/skip"
 	"path/filepath"
 	"runtime"
+	"sync"
 )
 
-// memorySegment wraps an im-memory skip list and is backed by a sequential access log file.
-// The list uses a nil Value to designate a key that has been removed from the table.
+// memorySegment wraps an im-memory table and is backed by a sequential access log file.
+// The table uses an empty Value to designate a key that has been removed.
 type memorySegment struct {
-	list    skip.SkipList[KeyValue]
+	table   memtable
 	log     *logFile
 	id      uint64
-	bytes   uint64
 	path    string
 	options Options
+	// writers that have logged their entries, but not yet applied them to the table
+	writers sync.WaitGroup
 }
 
 func newMemorySegment(path string, id uint64, options Options) *memorySegment {
 	ms := new(memorySegment)
-	ms.list = skip.NewSkipList(keyValueCompare(options))
+	ms.table = newMemtable(options)
 	ms.id = id
 	ms.path = path
 	ms.options = options
@@ -56,33 +57,29 @@ func (ms *memorySegment) maybeCreateLogFile() error {
 }
 
 func (ms *memorySegment) size() uint64 {
-	return ms.bytes
+	return ms.table.size()
 }
 
-func (ms *memorySegment) Put(key []byte, value []byte) ([]byte, error) {
+func (ms *memorySegment) Put(key []byte, value []byte) error {
 	err := ms.maybeCreateLogFile()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	prev := ms.list.Put(KeyValue{key: key, value: value})
-	ms.bytes += uint64(len(key) + len(value) - len(prev.key) - len(prev.value))
+	ms.table.put(KeyValue{key: key, value: value}, 0)
 	if ms.log != nil {
-		err = ms.log.Write(key, value)
-		if err != nil {
-			return prev.value, err
-		}
+		return ms.log.Write(key, value)
 	}
-	return prev.value, nil
+	return nil
 }
 func (ms *memorySegment) Get(key []byte) ([]byte, error) {
-	value, ok := ms.list.Get(Key(key))
+	value, ok := ms.table.get(key)
 	if !ok {
 		return nil, KeyNotFound
 	}
 	return value.value, nil
 }
 
-func (ms *memorySegment) Remove(key []byte) ([]byte, error) {
+func (ms *memorySegment) Remove(key []byte) error {
 	return ms.Put(key, emptyBytes)
 }
 
@@ -101,8 +98,7 @@ func (ms *memorySegment) Write(wb WriteBatch) error {
 	}
 
 	for _, kv := range wb.entries {
-		prev := ms.list.Put(kv)
-		ms.bytes += uint64(len(kv.key) + len(kv.value) - len(prev.key) - len(prev.value))
+		ms.table.put(kv, 0)
 		if ms.log != nil {
 			err := ms.log.Write(kv.key, kv.value)
 			if err != nil {
@@ -119,8 +115,80 @@ func (ms *memorySegment) Write(wb WriteBatch) error {
 	return nil
 }
 
+// logGroup appends the entries of all writers that have not disabled the log with a single flush, syncing
+// the log if any writer requested it. The writers then apply their own entries concurrently.
+func (ms *memorySegment) logGroup(writers []*writer) error {
+	logged, sync := false, false
+	for _, w := range writers {
+		logged = logged || !w.options.DisableWAL
+		sync = sync || w.options.Sync
+	}
+
+	if logged {
+		err := ms.maybeCreateLogFile()
+		if err != nil {
+			return err
+		}
+	}
+	if logged && ms.log != nil {
+		ms.log.StartGroup()
+		return errn(ms.appendGroup(writers), ms.log.EndGroup(sync))
+	}
+	return nil
+}
+
+// logBytes returns the number of bytes written to the log
+func (ms *memorySegment) logBytes() uint64 {
+	if ms.log == nil {
+		return 0
+	}
+	return ms.log.written
+}
+
+// apply inserts the entries of a logged writer into the table. It may be called concurrently by multiple writers,
+// and the seq of the writer ensures that the latest update of a key is retained.
+func (ms *memorySegment) apply(w *writer) {
+	defer ms.writers.Done()
+	for _, kv := range w.entries {
+		ms.table.put(kv, w.seq)
+	}
+}
+
+// waitForWriters waits until all logged writers have applied their entries, and must be called before the segment
+// becomes immutable
+func (ms *memorySegment) waitForWriters() {
+	ms.writers.Wait()
+}
+
+func (ms *memorySegment) appendGroup(writers []*writer) error {
+	for _, w := range writers {
+		if w.options.DisableWAL {
+			continue
+		}
+		if w.batch {
+			err := ms.log.StartBatch(len(w.entries))
+			if err != nil {
+				return err
+			}
+		}
+		for _, kv := range w.entries {
+			err := ms.log.Write(kv.key, kv.value)
+			if err != nil {
+				return err
+			}
+		}
+		if w.batch {
+			err := ms.log.EndBatch(len(w.entries))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (ms *memorySegment) Lookup(lower []byte, upper []byte) (LookupIterator, error) {
-	itr := ms.list.Iterator()
+	itr := ms.table.iterator()
 	if lower != nil {
 		itr.Seek(Key(lower))
 	} else {
@@ -129,6 +197,21 @@ func (ms *memorySegment) Lookup(lower []byte, upper []byte) (LookupIterator, err
 	return &skiplistIterator{itr: itr, lower: Key(lower), upper: Key(upper), cmp: keyValueCompare(ms.options)}, nil
 }
 
+// LookupKeys is the same as Lookup since the values are already in memory
+func (ms *memorySegment) LookupKeys(lower []byte, upper []byte) (LookupIterator, error) {
+	return ms.Lookup(lower, upper)
+}
+
+// GetUnsafe is the same as Get since the values are already in memory
+func (ms *memorySegment) GetUnsafe(key []byte) ([]byte, error) {
+	return ms.Get(key)
+}
+
+// LookupUnsafe is the same as Lookup since the values are already in memory
+func (ms *memorySegment) LookupUnsafe(lower []byte, upper []byte) (LookupIterator, error) {
+	return ms.Lookup(lower, upper)
+}
+
 func (ms *memorySegment) Close() error {
 	if ms.log != nil {
 		err := ms.log.Close()
@@ -148,28 +231,29 @@ func (ms *memorySegment) removeSegment() error {
 	return errn(err0, err1)
 }
 
-func (ms *memorySegment) removeOnFinalize() {
-	runtime.SetFinalizer(ms, func(ms *memorySegment) {
-		ms.removeSegment()
-	})
+func (ms *memorySegment) removeOnFinalize(remove func(s segment)) {
+	runtime.SetFinalizer(ms, func(ms *memorySegment) { remove(ms) })
 }
 
 func (ms *memorySegment) files() []string {
 	if ms.log != nil {
-		return []string{filepath.Base(ms.log.file.Name())}
+		return []string{filepath.Base(ms.log.name)}
 	} else {
 		return []string{}
 	}
 }
 
 type skiplistIterator struct {
-	itr   skip.Iterator[KeyValue]
+	itr   memtableIterator
 	lower KeyValue
 	upper KeyValue
 	cmp   func(KeyValue, KeyValue) int
+	// length of the value last returned by Next
+	valueLen int
 }
 
 func (es *skiplistIterator) Next() (key []byte, value []byte, err error) {
+	es.valueLen = 0
 	if !es.itr.Valid() {
 		return nil, nil, EndOfIterator
 	}
@@ -178,9 +262,14 @@ func (es *skiplistIterator) Next() (key []byte, value []byte, err error) {
 		return nil, nil, EndOfIterator
 	}
 	defer es.itr.Next()
+	es.valueLen = len(k.value)
 	return k.key, k.value, nil
 }
 
+func (es *skiplistIterator) valueSize() int {
+	return es.valueLen
+}
+
 func (es *skiplistIterator) peekKey() ([]byte, error) {
 	if !es.itr.Valid() {
 		return nil, EndOfIterator
@@ -17,9 +17,26 @@ func TestMemorySegment_Put(t *testing.T) {
 func TestMemorySegment_Remove(t *testing.T) {
 	ms := newMemoryOnlySegment()
 	ms.Put([]byte("mykey"), []byte("myvalue"))
-	val, err := ms.Remove([]byte("mykey"))
-	if err != nil || !bytes.Equal(val, []byte("myvalue")) {
-		t.Fail()
+	err := ms.Remove([]byte("mykey"))
+	if err != nil {
+		t.Fatal("unable to remove", err)
+	}
+	// the removed key is retained with an empty value, so that it hides the key in older segments
+	val, err := ms.Get([]byte("mykey"))
+	if err != nil || val == nil || len(val) != 0 {
+		t.Fatal("removed key should have an empty value", val, err)
+	}
+}
+
+func TestMemorySegment_Replace(t *testing.T) {
+	for _, mt := range []memtableType{SkipListMemtable, ArenaMemtable, VectorMemtable, HashSkipListMemtable} {
+		ms := newMemorySegment("", 0, Options{MemtableType: mt})
+		ms.Put([]byte("mykey"), []byte("myvalue"))
+		ms.Put([]byte("mykey"), []byte("myvalue2"))
+		val, err := ms.Get([]byte("mykey"))
+		if err != nil || !bytes.Equal(val, []byte("myvalue2")) {
+			t.Fatal("incorrect value", mt, string(val), err)
+		}
 	}
 }
 
@@ -0,0 +1,320 @@
+package leveldb
+
+import (
+	"container/heap"
+	"hash/maphash"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/robaho/leveldb/skip"
+)
+
+// memtable is the sorted in-memory table of a memory segment or log segment. put may be called concurrently with
+// other calls to put and with readers.
+type memtable interface {
+	// put inserts or replaces the entry for kv.key, unless the existing entry has a greater seq. It returns false
+	// if kv was not applied.
+	put(kv KeyValue, seq uint64) bool
+	get(key []byte) (KeyValue, bool)
+	iterator() memtableIterator
+	// size returns the number of bytes of memory used by the table
+	size() uint64
+}
+
+// memtableIterator is implemented by skip.Iterator
+type memtableIterator interface {
+	Valid() bool
+	Next()
+	SeekToFirst()
+	Seek(key KeyValue)
+	Key() KeyValue
+}
+
+func newMemtable(options Options) memtable {
+	switch options.MemtableType {
+	case ArenaMemtable:
+		return newArenaMemtable(options)
+	case VectorMemtable:
+		return newVectorMemtable(options)
+	case HashSkipListMemtable:
+		return newHashSkipListMemtable(options)
+	default:
+		return newSkiplistMemtable(options)
+	}
+}
+
+// skiplistMemtable is a skip.SkipList of heap allocated nodes
+type skiplistMemtable struct {
+	list skip.SkipList[KeyValue]
+	// bytes used by the keys and values, atomically updated
+	bytes uint64
+}
+
+func newSkiplistMemtable(options Options) *skiplistMemtable {
+	return &skiplistMemtable{list: skip.NewSkipList(keyValueCompare(options))}
+}
+
+func (t *skiplistMemtable) put(kv KeyValue, seq uint64) bool {
+	prev, ok := t.list.PutConcurrently(kv, seq)
+	if ok {
+		atomic.AddUint64(&t.bytes, uint64(len(kv.key)+len(kv.value)-len(prev.key)-len(prev.value)))
+	}
+	return ok
+}
+
+func (t *skiplistMemtable) get(key []byte) (KeyValue, bool) {
+	return t.list.Get(Key(key))
+}
+
+func (t *skiplistMemtable) iterator() memtableIterator {
+	itr := t.list.Iterator()
+	return &itr
+}
+
+func (t *skiplistMemtable) size() uint64 {
+	return atomic.LoadUint64(&t.bytes) + uint64(t.list.MemoryUsage())
+}
+
+// vectorMemtable appends entries to an unsorted vector, which is sorted when the table is iterated. It is the
+// fastest table for bulk loading, but reading while writing is expensive, since get scans the entries put since the
+// last iteration, and the first iteration after a write sorts the new entries and merges them with the previously
+// sorted entries.
+type vectorMemtable struct {
+	cmp func(a, b KeyValue) int
+	mu  sync.Mutex
+	// unsorted entries, in the order they were put
+	pending []vectorEntry
+	// sorted unique entries, never modified once sorted, so iterators can use it without locking
+	sorted []vectorEntry
+	// bytes used by the keys and values, including replaced entries, atomically updated
+	bytes uint64
+}
+
+type vectorEntry struct {
+	kv  KeyValue
+	seq uint64
+}
+
+func newVectorMemtable(options Options) *vectorMemtable {
+	return &vectorMemtable{cmp: keyValueCompare(options)}
+}
+
+// put always applies kv, since the entries are only compared when sorted
+func (t *vectorMemtable) put(kv KeyValue, seq uint64) bool {
+	t.mu.Lock()
+	t.pending = append(t.pending, vectorEntry{kv: kv, seq: seq})
+	t.mu.Unlock()
+	atomic.AddUint64(&t.bytes, uint64(len(kv.key)+len(kv.value))+uint64(unsafe.Sizeof(vectorEntry{})))
+	return true
+}
+
+// entries returns the sorted entries, after merging any pending entries
+func (t *vectorMemtable) entries() []vectorEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.pending) == 0 {
+		return t.sorted
+	}
+	// a stable sort retains the put order of entries with the same key and seq, so the last put is retained
+	sort.SliceStable(t.pending, func(i, j int) bool {
+		c := t.cmp(t.pending[i].kv, t.pending[j].kv)
+		return c < 0 || (c == 0 && t.pending[i].seq < t.pending[j].seq)
+	})
+
+	merged := make([]vectorEntry, 0, len(t.sorted)+len(t.pending))
+	i, j := 0, 0
+	for i < len(t.sorted) || j < len(t.pending) {
+		if j == len(t.pending) {
+			merged = append(merged, t.sorted[i])
+			i++
+			continue
+		}
+		e := t.pending[j]
+		j++
+		if j < len(t.pending) && t.cmp(e.kv, t.pending[j].kv) == 0 {
+			// a later entry for the same key has a greater or equal seq
+			continue
+		}
+		for i < len(t.sorted) && t.cmp(t.sorted[i].kv, e.kv) < 0 {
+			merged = append(merged, t.sorted[i])
+			i++
+		}
+		if i < len(t.sorted) && t.cmp(t.sorted[i].kv, e.kv) == 0 {
+			if t.sorted[i].seq > e.seq {
+				e = t.sorted[i]
+			}
+			i++
+		}
+		merged = append(merged, e)
+	}
+	t.sorted = merged
+	t.pending = t.pending[:0]
+	return t.sorted
+}
+
+// get scans the pending entries rather than merging them, so that reads between writes do not sort the table
+func (t *vectorMemtable) get(key []byte) (KeyValue, bool) {
+	t.mu.Lock()
+	var found vectorEntry
+	ok := false
+	for _, e := range t.pending {
+		// the last put is retained for entries with the same seq, as when sorted
+		if t.cmp(e.kv, Key(key)) == 0 && (!ok || e.seq >= found.seq) {
+			found, ok = e, true
+		}
+	}
+	sorted := t.sorted
+	t.mu.Unlock()
+
+	i := sort.Search(len(sorted), func(i int) bool { return t.cmp(sorted[i].kv, Key(key)) >= 0 })
+	if i < len(sorted) && t.cmp(sorted[i].kv, Key(key)) == 0 && (!ok || sorted[i].seq > found.seq) {
+		return sorted[i].kv, true
+	}
+	return found.kv, ok
+}
+
+func (t *vectorMemtable) iterator() memtableIterator {
+	return &vectorIterator{t: t}
+}
+
+func (t *vectorMemtable) size() uint64 {
+	return atomic.LoadUint64(&t.bytes)
+}
+
+type vectorIterator struct {
+	t       *vectorMemtable
+	entries []vectorEntry
+	index   int
+}
+
+func (i *vectorIterator) Valid() bool {
+	return i.index < len(i.entries)
+}
+
+func (i *vectorIterator) Next() {
+	i.index++
+}
+
+func (i *vectorIterator) SeekToFirst() {
+	i.entries = i.t.entries()
+	i.index = 0
+}
+
+func (i *vectorIterator) Seek(key KeyValue) {
+	i.entries = i.t.entries()
+	i.index = sort.Search(len(i.entries), func(j int) bool { return i.t.cmp(i.entries[j].kv, key) >= 0 })
+}
+
+func (i *vectorIterator) Key() KeyValue {
+	return i.entries[i.index].kv
+}
+
+const hashSkipListBuckets = 16
+
+// hashSkipListMemtable partitions the keys by hash into multiple skip lists, so that point lookups search a smaller
+// list and concurrent writers contend less, at the cost of merging the lists when iterating. Keys that compare
+// equal must be identical.
+type hashSkipListMemtable struct {
+	seed    maphash.Seed
+	cmp     func(a, b KeyValue) int
+	buckets [hashSkipListBuckets]*skiplistMemtable
+}
+
+func newHashSkipListMemtable(options Options) *hashSkipListMemtable {
+	t := &hashSkipListMemtable{seed: maphash.MakeSeed(), cmp: keyValueCompare(options)}
+	for i := range t.buckets {
+		t.buckets[i] = newSkiplistMemtable(options)
+	}
+	return t
+}
+
+func (t *hashSkipListMemtable) bucket(key []byte) *skiplistMemtable {
+	return t.buckets[maphash.Bytes(t.seed, key)%hashSkipListBuckets]
+}
+
+func (t *hashSkipListMemtable) put(kv KeyValue, seq uint64) bool {
+	return t.bucket(kv.key).put(kv, seq)
+}
+
+func (t *hashSkipListMemtable) get(key []byte) (KeyValue, bool) {
+	return t.bucket(key).get(key)
+}
+
+func (t *hashSkipListMemtable) iterator() memtableIterator {
+	itr := &hashSkipListIterator{cmp: t.cmp}
+	for _, b := range t.buckets {
+		itr.itrs = append(itr.itrs, b.iterator())
+	}
+	return itr
+}
+
+func (t *hashSkipListMemtable) size() uint64 {
+	var size uint64
+	for _, b := range t.buckets {
+		size += b.size()
+	}
+	return size
+}
+
+// hashSkipListIterator merges the bucket iterators, using a heap of the valid iterators ordered by key
+type hashSkipListIterator struct {
+	cmp  func(a, b KeyValue) int
+	itrs []memtableIterator
+	heap []memtableIterator
+}
+
+func (i *hashSkipListIterator) Len() int { return len(i.heap) }
+func (i *hashSkipListIterator) Less(a, b int) bool {
+	return i.cmp(i.heap[a].Key(), i.heap[b].Key()) < 0
+}
+func (i *hashSkipListIterator) Swap(a, b int) { i.heap[a], i.heap[b] = i.heap[b], i.heap[a] }
+func (i *hashSkipListIterator) Push(x any)    { i.heap = append(i.heap, x.(memtableIterator)) }
+func (i *hashSkipListIterator) Pop() any {
+	x := i.heap[len(i.heap)-1]
+	i.heap = i.heap[:len(i.heap)-1]
+	return x
+}
+
+func (i *hashSkipListIterator) init() {
+	i.heap = i.heap[:0]
+	for _, itr := range i.itrs {
+		if itr.Valid() {
+			i.heap = append(i.heap, itr)
+		}
+	}
+	heap.Init(i)
+}
+
+func (i *hashSkipListIterator) Valid() bool {
+	return len(i.heap) > 0
+}
+
+func (i *hashSkipListIterator) Next() {
+	i.heap[0].Next()
+	if i.heap[0].Valid() {
+		heap.Fix(i, 0)
+	} else {
+		heap.Pop(i)
+	}
+}
+
+func (i *hashSkipListIterator) SeekToFirst() {
+	for _, itr := range i.itrs {
+		itr.SeekToFirst()
+	}
+	i.init()
+}
+
+func (i *hashSkipListIterator) Seek(key KeyValue) {
+	for _, itr := range i.itrs {
+		itr.Seek(key)
+	}
+	i.init()
+}
+
+func (i *hashSkipListIterator) Key() KeyValue {
+	return i.heap[0].Key()
+}
@@ -0,0 +1,139 @@
+package leveldb
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func testMemtable(t *testing.T, options Options) {
+	table := newMemtable(options)
+	if _, ok := table.get([]byte("mykey")); ok {
+		t.Fatal("empty table should not contain key")
+	}
+	size := table.size()
+
+	table.put(KeyValue{key: []byte("mykey2"), value: []byte("myvalue2")}, 1)
+	table.put(KeyValue{key: []byte("mykey1"), value: []byte("myvalue1")}, 2)
+	table.put(KeyValue{key: []byte("mykey3"), value: emptyBytes}, 3)
+	table.put(KeyValue{key: []byte("mykey4")}, 4)
+
+	table.put(KeyValue{key: []byte("mykey1"), value: []byte("myvalue0")}, 1)
+	table.put(KeyValue{key: []byte("mykey2"), value: []byte("myvalue22")}, 5)
+	if table.size() <= size {
+		t.Fatal("size should increase", table.size(), size)
+	}
+
+	kv, ok := table.get([]byte("mykey1"))
+	if !ok || !bytes.Equal(kv.value, []byte("myvalue1")) {
+		t.Fatal("older entry should not be applied", string(kv.value))
+	}
+	kv, ok = table.get([]byte("mykey2"))
+	if !ok || !bytes.Equal(kv.value, []byte("myvalue22")) {
+		t.Fatal("newer entry should be applied", string(kv.value))
+	}
+	kv, ok = table.get([]byte("mykey3"))
+	if !ok || kv.value == nil || len(kv.value) != 0 {
+		t.Fatal("removed key should have an empty value", kv.value)
+	}
+	kv, ok = table.get([]byte("mykey4"))
+	if !ok || kv.value != nil {
+		t.Fatal("nil value should be retained", kv.value)
+	}
+
+	itr := table.iterator()
+	itr.Seek(Key([]byte("mykey2")))
+	for i := 2; i <= 4; i++ {
+		if !itr.Valid() || string(itr.Key().key) != fmt.Sprint("mykey", i) {
+			t.Fatal("incorrect key", i)
+		}
+		itr.Next()
+	}
+	if itr.Valid() {
+		t.Fatal("iterator should be exhausted")
+	}
+	table.put(KeyValue{key: []byte("mykey2"), value: []byte("myvalue21")}, 2)
+	kv, ok = table.get([]byte("mykey2"))
+	if !ok || !bytes.Equal(kv.value, []byte("myvalue22")) {
+		t.Fatal("older entry should not be applied after iterating", string(kv.value))
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 10000; i++ {
+				table.put(KeyValue{key: []byte(fmt.Sprintf("key%05d", i)), value: []byte(fmt.Sprint("value", w))}, uint64(10+w))
+			}
+		}(w)
+	}
+	wg.Wait()
+	count := 0
+	for itr.SeekToFirst(); itr.Valid(); itr.Next() {
+		if bytes.HasPrefix(itr.Key().key, []byte("key")) {
+			if !bytes.Equal(itr.Key().value, []byte("value3")) {
+				t.Fatal("latest entry should be retained", string(itr.Key().value))
+			}
+			count++
+		}
+	}
+	if count != 10000 {
+		t.Fatal("incorrect count", count)
+	}
+}
+
+func TestSkipListMemtable(t *testing.T) {
+	testMemtable(t, Options{MemtableType: SkipListMemtable})
+}
+
+func TestArenaMemtable(t *testing.T) {
+	testMemtable(t, Options{MemtableType: ArenaMemtable})
+}
+
+func TestVectorMemtable(t *testing.T) {
+	testMemtable(t, Options{MemtableType: VectorMemtable})
+}
+
+func TestHashSkipListMemtable(t *testing.T) {
+	testMemtable(t, Options{MemtableType: HashSkipListMemtable})
+}
+
+func TestVectorMemtable_Iterator(t *testing.T) {
+	table := newMemtable(Options{MemtableType: VectorMemtable})
+	table.put(KeyValue{key: []byte("mykey1"), value: []byte("myvalue1")}, 0)
+	itr := table.iterator()
+	itr.SeekToFirst()
+	// entries put after the iterator is positioned are not visible to it
+	table.put(KeyValue{key: []byte("mykey0"), value: []byte("myvalue0")}, 0)
+	table.put(KeyValue{key: []byte("mykey1"), value: []byte("myvalue2")}, 0)
+	if !itr.Valid() || string(itr.Key().value) != "myvalue1" {
+		t.Fatal("incorrect value")
+	}
+	itr.Next()
+	if itr.Valid() {
+		t.Fatal("iterator should be exhausted")
+	}
+	itr.SeekToFirst()
+	if !itr.Valid() || string(itr.Key().key) != "mykey0" {
+		t.Fatal("incorrect key")
+	}
+	itr.Next()
+	if !itr.Valid() || string(itr.Key().value) != "myvalue2" {
+		t.Fatal("last put should be retained")
+	}
+}
+
+func TestArenaMemtable_LargeValue(t *testing.T) {
+	table := newMemtable(Options{MemtableType: ArenaMemtable})
+	value := bytes.Repeat([]byte("x"), 1024*1024)
+	table.put(KeyValue{key: []byte("mykey"), value: value}, 0)
+	kv, ok := table.get([]byte("mykey"))
+	if !ok || !bytes.Equal(kv.value, value) {
+		t.Fatal("incorrect value")
+	}
+	if table.size() < uint64(len(value)) {
+		t.Fatal("size should include the value", table.size())
+	}
+}
@@ -1,7 +1,6 @@
 package leveldb
 
 import (
-	"errors"
 	"fmt"
 	"path/filepath"
 	"sync/atomic"
@@ -11,7 +10,6 @@ import (
 // merge segments for the database
 func mergeSegments(db *Database) {
 	defer db.wg.Done()
-	//defer fmt.Println("merger complete on "+db.path)
 
 	for {
 		select {
@@ -20,21 +18,22 @@ func mergeSegments(db *Database) {
 		case <-db.merger:
 			break
 		}
-		if atomic.LoadInt32(&db.closing) > 0 || db.err != nil {
+		if atomic.LoadInt32(&db.closing) > 0 {
 			return
 		}
+		if atomic.LoadInt32(&db.failed) > 0 || db.getOptions().DisableAutoMerge {
+			continue
+		}
 
 		// the following prevents a Close from occurring while this
 		// routine is running
 
 		db.wg.Add(1)
 
-		err := mergeSegments0(db, db.options.MaxSegments, true)
-		db.Lock()
+		err := mergeSegments0(db, db.getOptions().MaxSegments, true)
 		if err != nil {
-			db.err = errors.New("unable to merge segments: " + err.Error())
+			db.backgroundError(fmt.Errorf("unable to merge segments: %w", err))
 		}
-		db.Unlock()
 
 		db.wg.Done()
 	}
@@ -51,12 +50,17 @@ func mergeSegments0(db *Database, segmentCount uint, throttle bool) error {
 	}
 	defer atomic.StoreInt32(&db.inMerge, 0)
 
-	//fmt.Println("merging segments", db.path)
-
 	for {
 
 		segments := db.getState().segments
 
+		// only the disk segments are merged, the segments held in memory are written to disk by the flusher
+		disk := 0
+		for disk < len(segments) && isDiskSegment(segments[disk]) {
+			disk++
+		}
+		segments = segments[:disk]
+
 		if len(segments) <= int(segmentCount) {
 			return nil
 		}
@@ -92,10 +96,33 @@ func mergeSegments0(db *Database, segmentCount uint, throttle bool) error {
 
 		segments = segments[index : index+len(mergable)]
 
-		newseg, err := mergeSegments1(db.deleter, db.path, segments, index == 0)
+		info := MergeInfo{Path: db.path, OutputSegment: SegmentID{Lower: segments[0].LowerID(), Upper: segments[len(segments)-1].UpperID()}}
+		for _, s := range segments {
+			info.InputSegments = append(info.InputSegments, segmentID(s))
+			info.BytesRead += s.size()
+		}
+		db.events().OnMergeBegin(info)
+
+		start := time.Now()
+		newseg, err := mergeSegments1(*db.getOptions(), db.deleter, db.path, segments, index == 0)
 		if err != nil {
+			err = ioError(db.path, info.OutputSegment, err)
+		}
+		info.Duration, info.Err = time.Since(start), err
+		if newseg != nil {
+			info.BytesWritten = newseg.size()
+		}
+		db.events().OnMergeEnd(info)
+		if err != nil {
+			db.logger().Error("merge failed", segmentAttr("output", info.OutputSegment), "error", err)
 			return err
 		}
+		db.logger().Info("merged segments", "inputs", len(info.InputSegments), segmentAttr("output", info.OutputSegment),
+			"bytesRead", info.BytesRead, "bytesWritten", info.BytesWritten, "duration", info.Duration)
+		atomic.AddUint64(&db.stats.merges, 1)
+		atomic.AddInt64(&db.stats.mergeTime, int64(info.Duration))
+		atomic.AddUint64(&db.stats.mergeBytesRead, info.BytesRead)
+		atomic.AddUint64(&db.stats.mergeBytesWritten, info.BytesWritten)
 
 		db.Lock() // need lock when updating db segments
 		segments = db.state.segments
@@ -107,7 +134,7 @@ func mergeSegments0(db *Database, segmentCount uint, throttle bool) error {
 		}
 
 		for _, s := range mergable {
-			s.removeOnFinalize()
+			s.removeOnFinalize(db.removeMergedSegment)
 
 			if err != nil {
 				db.Unlock()
@@ -125,12 +152,29 @@ func mergeSegments0(db *Database, segmentCount uint, throttle bool) error {
 		index++
 		db.Unlock()
 		if throttle {
-			time.Sleep(100 * time.Millisecond)
+			time.Sleep(db.getOptions().MergeThrottle)
 		}
 	}
 }
 
-func mergeSegments1(deleter Deleter, dbpath string, segments []segment, purgeDeleted bool) (segment, error) {
+// removeMergedSegment removes the files of a merged segment once it is no longer referenced. Once the database is
+// closing the files are removed by the deleter instead, since a new database at the same path may reuse the file
+// names by the time the segment is finalized, so the segment is only closed. The global lock orders the removal
+// with Close and Open.
+func (db *Database) removeMergedSegment(s segment) {
+	global_lock.Lock()
+	defer global_lock.Unlock()
+
+	if atomic.LoadInt32(&db.closing) > 0 {
+		s.Close()
+		return
+	}
+	if s.removeSegment() == nil {
+		db.segmentDeleted(s.files())
+	}
+}
+
+func mergeSegments1(options Options, deleter Deleter, dbpath string, segments []segment, purgeDeleted bool) (segment, error) {
 
 	lowerId := segments[0].LowerID()
 	upperId := segments[len(segments)-1].UpperID()
@@ -149,7 +193,7 @@ func mergeSegments1(deleter Deleter, dbpath string, segments []segment, purgeDel
 		return nil, err
 	}
 
-	seg, err := writeAndLoadSegment(keyFilename, dataFilename, itr, purgeDeleted)
+	seg, err := writeAndLoadSegment(options, keyFilename, dataFilename, itr, purgeDeleted)
 	if err != nil {
 		return nil, err
 	}
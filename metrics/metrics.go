@@ -0,0 +1,215 @@
+// Package metrics exports the statistics of leveldb databases using expvar, and as a handler serving the
+// Prometheus text format, labeled by the database path.
+package metrics
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robaho/leveldb"
+)
+
+// Registry is a set of databases whose statistics are exported
+type Registry struct {
+	mu  sync.Mutex
+	dbs map[string]*leveldb.Database
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{dbs: make(map[string]*leveldb.Database)}
+}
+
+var defaultRegistry = NewRegistry()
+var publishOnce sync.Once
+
+// Register adds the database to the default registry, which is published using expvar as "leveldb"
+func Register(db *leveldb.Database) {
+	publishOnce.Do(func() {
+		expvar.Publish("leveldb", expvar.Func(defaultRegistry.expvar))
+	})
+	defaultRegistry.Register(db)
+}
+
+// Unregister removes the database from the default registry
+func Unregister(db *leveldb.Database) {
+	defaultRegistry.Unregister(db)
+}
+
+// Handler returns a handler that serves the statistics of the databases in the default registry in the
+// Prometheus text format
+func Handler() http.Handler {
+	return defaultRegistry.Handler()
+}
+
+// Register adds the database to the registry, replacing any database with the same path
+func (r *Registry) Register(db *leveldb.Database) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dbs[db.Path()] = db
+}
+
+// Unregister removes the database from the registry
+func (r *Registry) Unregister(db *leveldb.Database) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dbs[db.Path()] == db {
+		delete(r.dbs, db.Path())
+	}
+}
+
+// stats returns the statistics of the registered databases by path
+func (r *Registry) stats() map[string]leveldb.Statistics {
+	r.mu.Lock()
+	dbs := make(map[string]*leveldb.Database, len(r.dbs))
+	for path, db := range r.dbs {
+		dbs[path] = db
+	}
+	r.mu.Unlock()
+
+	stats := make(map[string]leveldb.Statistics, len(dbs))
+	for path, db := range dbs {
+		stats[path] = db.Stats()
+	}
+	return stats
+}
+
+func (r *Registry) expvar() any {
+	return r.stats()
+}
+
+// Handler returns a handler that serves the statistics of the registered databases in the Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WritePrometheus(w)
+	})
+}
+
+// WritePrometheus writes the statistics of the registered databases in the Prometheus text format
+func (r *Registry) WritePrometheus(out io.Writer) error {
+	stats := r.stats()
+	paths := make([]string, 0, len(stats))
+	for path := range stats {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	w := bufio.NewWriter(out)
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+		for _, path := range paths {
+			m.write(w, m.name, label("path", path), stats[path])
+		}
+	}
+	return w.Flush()
+}
+
+type metric struct {
+	name  string
+	kind  string
+	help  string
+	write func(w io.Writer, name string, labels string, s leveldb.Statistics)
+}
+
+func counter(name string, help string, value func(s leveldb.Statistics) float64) metric {
+	return metric{name: name, kind: "counter", help: help, write: sample(value)}
+}
+
+func gauge(name string, help string, value func(s leveldb.Statistics) float64) metric {
+	return metric{name: name, kind: "gauge", help: help, write: sample(value)}
+}
+
+func sample(value func(s leveldb.Statistics) float64) func(w io.Writer, name string, labels string, s leveldb.Statistics) {
+	return func(w io.Writer, name string, labels string, s leveldb.Statistics) {
+		fmt.Fprintf(w, "%s{%s} %v\n", name, labels, value(s))
+	}
+}
+
+// byLabel writes a sample for each value of the label
+func byLabel(name string, kind string, help string, label string, values map[string]func(s leveldb.Statistics) float64) metric {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return metric{name: name, kind: kind, help: help, write: func(w io.Writer, name string, labels string, s leveldb.Statistics) {
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s{%s,%s=\"%s\"} %v\n", name, labels, label, k, values[k](s))
+		}
+	}}
+}
+
+func latency(name string, help string) metric {
+	histograms := map[string]func(s leveldb.Statistics) leveldb.Histogram{
+		"get":    func(s leveldb.Statistics) leveldb.Histogram { return s.GetLatency },
+		"put":    func(s leveldb.Statistics) leveldb.Histogram { return s.PutLatency },
+		"write":  func(s leveldb.Statistics) leveldb.Histogram { return s.WriteLatency },
+		"lookup": func(s leveldb.Statistics) leveldb.Histogram { return s.LookupLatency },
+	}
+	ops := []string{"get", "lookup", "put", "write"}
+	return metric{name: name, kind: "histogram", help: help, write: func(w io.Writer, name string, labels string, s leveldb.Statistics) {
+		for _, op := range ops {
+			h := histograms[op](s)
+			opLabels := labels + "," + label("op", op)
+			cumulative := uint64(0)
+			for i, count := range h.Buckets {
+				cumulative += count
+				le := "+Inf"
+				if i < len(h.Buckets)-1 {
+					le = fmt.Sprint(leveldb.BucketUpperBound(i).Seconds())
+				}
+				fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, opLabels, le, cumulative)
+			}
+			fmt.Fprintf(w, "%s_sum{%s} %v\n", name, opLabels, h.Sum.Seconds())
+			fmt.Fprintf(w, "%s_count{%s} %d\n", name, opLabels, h.Count)
+		}
+	}}
+}
+
+func seconds(d time.Duration) float64 {
+	return d.Seconds()
+}
+
+var metrics = []metric{
+	latency("leveldb_operation_duration_seconds", "Latency of database operations."),
+	byLabel("leveldb_bytes_written_total", "counter", "Bytes written by the user, to the write ahead log, and to segments by flushes and merges.", "kind", map[string]func(s leveldb.Statistics) float64{
+		"user":  func(s leveldb.Statistics) float64 { return float64(s.BytesWritten) },
+		"wal":   func(s leveldb.Statistics) float64 { return float64(s.WALBytesWritten) },
+		"flush": func(s leveldb.Statistics) float64 { return float64(s.FlushBytesWritten) },
+		"merge": func(s leveldb.Statistics) float64 { return float64(s.MergeBytesWritten) },
+	}),
+	gauge("leveldb_write_amplification", "Bytes written to disk per byte written by the user.", func(s leveldb.Statistics) float64 { return s.WriteAmplification }),
+	counter("leveldb_flushes_total", "Number of memory and log segments written to disk.", func(s leveldb.Statistics) float64 { return float64(s.Flushes) }),
+	counter("leveldb_merges_total", "Number of segment merges.", func(s leveldb.Statistics) float64 { return float64(s.Merges) }),
+	counter("leveldb_merge_duration_seconds_total", "Time spent merging segments.", func(s leveldb.Statistics) float64 { return seconds(s.MergeTime) }),
+	counter("leveldb_merge_bytes_read_total", "Size of the segments that were merged.", func(s leveldb.Statistics) float64 { return float64(s.MergeBytesRead) }),
+	counter("leveldb_stalls_total", "Number of times writes were paused waiting for the flusher.", func(s leveldb.Statistics) float64 { return float64(s.Stalls) }),
+	counter("leveldb_stall_duration_seconds_total", "Time writes were paused waiting for the flusher.", func(s leveldb.Statistics) float64 { return seconds(s.StallTime) }),
+	gauge("leveldb_memtable_bytes", "Size of the current memory segment.", func(s leveldb.Statistics) float64 { return float64(s.MemtableBytes) }),
+	byLabel("leveldb_segments", "gauge", "Number of segments by type.", "type", map[string]func(s leveldb.Statistics) float64{
+		"memory": func(s leveldb.Statistics) float64 { return float64(s.MemorySegments) },
+		"log":    func(s leveldb.Statistics) float64 { return float64(s.LogSegments) },
+		"disk":   func(s leveldb.Statistics) float64 { return float64(s.DiskSegments) },
+	}),
+	byLabel("leveldb_segment_bytes", "gauge", "Size of the segments by type.", "type", map[string]func(s leveldb.Statistics) float64{
+		"memory": func(s leveldb.Statistics) float64 { return float64(s.MemorySegmentBytes) },
+		"log":    func(s leveldb.Statistics) float64 { return float64(s.LogSegmentBytes) },
+		"disk":   func(s leveldb.Statistics) float64 { return float64(s.DiskSegmentBytes) },
+	}),
+	gauge("leveldb_snapshots", "Number of open snapshots.", func(s leveldb.Statistics) float64 { return float64(s.Snapshots) }),
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func label(name string, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/robaho/leveldb"
+)
+
+func TestMetrics(t *testing.T) {
+	db, err := leveldb.Open("test/metricsdb", leveldb.Options{InMemory: true})
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	defer db.Close()
+
+	err = db.Put([]byte("mykey"), []byte("myvalue"))
+	if err != nil {
+		t.Fatal("unable to put key/value", err)
+	}
+	_, err = db.Get([]byte("mykey"))
+	if err != nil {
+		t.Fatal("unable to get", err)
+	}
+
+	Register(db)
+	defer Unregister(db)
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal("unable to get metrics", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal("unable to read metrics", err)
+	}
+
+	for _, expected := range []string{
+		"# TYPE leveldb_operation_duration_seconds histogram",
+		`leveldb_operation_duration_seconds_count{path="test/metricsdb",op="put"} 1`,
+		`leveldb_operation_duration_seconds_bucket{path="test/metricsdb",op="get",le="+Inf"} 1`,
+		`leveldb_segments{path="test/metricsdb",type="memory"} 1`,
+		`leveldb_bytes_written_total{path="test/metricsdb",kind="user"} 12`,
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Fatal("metrics do not contain", expected, string(body))
+		}
+	}
+
+	var vars map[string]leveldb.Statistics
+	err = json.Unmarshal([]byte(expvar.Get("leveldb").String()), &vars)
+	if err != nil {
+		t.Fatal("unable to decode expvar", err)
+	}
+	if vars["test/metricsdb"].PutLatency.Count != 1 {
+		t.Fatal("incorrect expvar statistics", vars)
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	if l := label("path", "a\"b\\c\nd"); l != `path="a\"b\\c\nd"` {
+		t.Fatal("incorrect escaping", l)
+	}
+}
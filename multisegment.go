@@ -8,10 +8,30 @@ type multiSegment struct {
 
 type multiSegmentIterator struct {
 	iterators []LookupIterator
+	// the iterator that produced the last key returned by Next
+	current LookupIterator
 }
 
+// peekKey returns the lowest next key of the iterators, so that a multiSegmentIterator can be nested
 func (msi *multiSegmentIterator) peekKey() ([]byte, error) {
-	panic("peekKey called on multiSegmentIterator")
+	var lowest []byte
+	for _, iterator := range msi.iterators {
+		key, err := iterator.peekKey()
+		for err == nil && key == nil {
+			iterator.Next()
+			key, err = iterator.peekKey()
+		}
+		if err != nil {
+			continue
+		}
+		if lowest == nil || less(key, lowest) {
+			lowest = key
+		}
+	}
+	if lowest == nil {
+		return nil, EndOfIterator
+	}
+	return lowest, nil
 }
 
 func (msi *multiSegmentIterator) Next() (key []byte, value []byte, err error) {
@@ -46,10 +66,12 @@ func (msi *multiSegmentIterator) Next() (key []byte, value []byte, err error) {
 	}
 
 	if currentIndex == -1 {
+		msi.current = nil
 		return nil, nil, EndOfIterator
 	}
 
-	key, value, err = msi.iterators[currentIndex].Next()
+	msi.current = msi.iterators[currentIndex]
+	key, value, err = msi.current.Next()
 
 	// advance all of the iterators past the current
 	for i := len(msi.iterators) - 1; i >= 0; i-- {
@@ -73,6 +95,13 @@ func (msi *multiSegmentIterator) Next() (key []byte, value []byte, err error) {
 	return
 }
 
+func (msi *multiSegmentIterator) valueSize() int {
+	if msi.current == nil {
+		return 0
+	}
+	return msi.current.valueSize()
+}
+
 func (ms *multiSegment) size() uint64 {
 	var size uint64 = 0
 	for _, s := range ms.segments {
@@ -91,7 +120,7 @@ func (ms *multiSegment) LowerID() uint64 {
 func (ms *multiSegment) UpperID() uint64 {
 	panic("MultiSegment does not have an UpperID")
 }
-func (ms *multiSegment) Put(key []byte, value []byte) ([]byte, error) {
+func (ms *multiSegment) Put(key []byte, value []byte) error {
 	panic("Put called on multiSegment")
 }
 func (ms *multiSegment) Close() error {
@@ -101,7 +130,7 @@ func (ms *multiSegment) Close() error {
 func (ms *multiSegment) removeSegment() error {
 	panic("removeSegment called on multiSegment")
 }
-func (ms *multiSegment) removeOnFinalize() {
+func (ms *multiSegment) removeOnFinalize(remove func(s segment)) {
 	panic("removeOnFinalize called on multiSegment")
 }
 func (ms *multiSegment) files() []string {
@@ -109,10 +138,18 @@ func (ms *multiSegment) files() []string {
 }
 
 func (ms *multiSegment) Get(key []byte) ([]byte, error) {
+	return ms.get(key, segment.Get)
+}
+
+func (ms *multiSegment) GetUnsafe(key []byte) ([]byte, error) {
+	return ms.get(key, segment.GetUnsafe)
+}
+
+func (ms *multiSegment) get(key []byte, get func(segment, []byte) ([]byte, error)) ([]byte, error) {
 	// segments are in chronological order, so search in reverse
 	for i := len(ms.segments) - 1; i >= 0; i-- {
 		s := ms.segments[i]
-		val, err := s.Get(key)
+		val, err := get(s, key)
 		if err == nil {
 			return val, nil
 		}
@@ -120,14 +157,26 @@ func (ms *multiSegment) Get(key []byte) ([]byte, error) {
 	return nil, KeyNotFound
 }
 
-func (ms *multiSegment) Remove(key []byte) ([]byte, error) {
+func (ms *multiSegment) Remove(key []byte) error {
 	panic("Remove called on multiSegmentIterator")
 }
 
 func (ms *multiSegment) Lookup(lower []byte, upper []byte) (LookupIterator, error) {
+	return ms.lookup(lower, upper, segment.Lookup)
+}
+
+func (ms *multiSegment) LookupKeys(lower []byte, upper []byte) (LookupIterator, error) {
+	return ms.lookup(lower, upper, segment.LookupKeys)
+}
+
+func (ms *multiSegment) LookupUnsafe(lower []byte, upper []byte) (LookupIterator, error) {
+	return ms.lookup(lower, upper, segment.LookupUnsafe)
+}
+
+func (ms *multiSegment) lookup(lower []byte, upper []byte, lookup func(segment, []byte, []byte) (LookupIterator, error)) (LookupIterator, error) {
 	iterators := make([]LookupIterator, 0)
 	for _, v := range ms.segments {
-		iterator, err := v.Lookup(lower, upper)
+		iterator, err := lookup(v, lower, upper)
 		if err != nil {
 			return nil, err
 		}
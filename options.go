@@ -0,0 +1,298 @@
+package leveldb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetOptions returns the effective options of the database, with the defaults applied
+func (db *Database) GetOptions() Options {
+	return *db.getOptions()
+}
+
+// SetOptions changes the options of an open database. MaxSegments, MaxMemoryBytes, MaxImmutableMemtables,
+// DisableAutoMerge, EnableSyncWrite, DisableWriteFlush, DisableSegmentSync and MergeThrottle can be changed, and an
+// error is returned if any other option differs from the effective options, see GetOptions. As with Open(), zero
+// values are replaced with the defaults. A change to DisableWriteFlush takes effect with the next memory segment.
+func (db *Database) SetOptions(options Options) error {
+	db.Lock()
+	defer db.Unlock()
+
+	if !db.open {
+		return DatabaseClosed
+	}
+
+	err := validateOptions(&options)
+	if err != nil {
+		return err
+	}
+	current := db.getOptions()
+	err = checkImmutableOptions(current, &options)
+	if err != nil {
+		return err
+	}
+	// CreateIfNeeded only applies to Open()
+	options.CreateIfNeeded = current.CreateIfNeeded
+
+	if !options.ReadOnly && hasOptionsFile(options.fs(), db.path) {
+		err = writeOptionsFile(options.fs(), db.path, &options)
+		if err != nil {
+			return err
+		}
+	}
+	db.setOptions(&options)
+	// producers paused for the flusher may be able to continue
+	db.flushed.Broadcast()
+	return nil
+}
+
+// validateOptions replaces the zero values of options with the defaults, and returns an error if an option is
+// invalid
+func validateOptions(options *Options) error {
+	if options.MaxSegments == 0 {
+		options.MaxSegments = dbMaxSegments
+	}
+	if options.MaxMemoryBytes == 0 {
+		options.MaxMemoryBytes = dbMemorySegment
+	}
+	if options.MaxMemoryBytes < dbMinMemorySegment {
+		return fmt.Errorf("%w: MaxMemoryBytes must be at least %d", InvalidOptions, dbMinMemorySegment)
+	}
+	if options.MaxImmutableMemtables == 0 {
+		options.MaxImmutableMemtables = dbMaxImmutableMemtables
+	}
+	if options.MaxImmutableMemtables < 0 {
+		return fmt.Errorf("%w: MaxImmutableMemtables must not be negative", InvalidOptions)
+	}
+	if options.MergeThrottle == 0 {
+		options.MergeThrottle = dbMergeThrottle
+	}
+	if options.MergeThrottle < 0 {
+		return fmt.Errorf("%w: MergeThrottle must not be negative", InvalidOptions)
+	}
+	if options.MemtableType < SkipListMemtable || options.MemtableType > HashSkipListMemtable {
+		return fmt.Errorf("%w: unknown MemtableType %d", InvalidOptions, options.MemtableType)
+	}
+	if options.UserKeyCompare == nil && options.UserKeyCompareName != "" && options.UserKeyCompareName != bytewiseCompareName {
+		return fmt.Errorf("%w: UserKeyCompareName %s requires UserKeyCompare", InvalidOptions, options.UserKeyCompareName)
+	}
+	if options.ReadOnly && options.InMemory {
+		return fmt.Errorf("%w: ReadOnly cannot be used with InMemory", InvalidOptions)
+	}
+	if options.BatchReadMode < DiscardPartial || options.BatchReadMode > ReturnOpenError {
+		return fmt.Errorf("%w: unknown BatchReadMode %d", InvalidOptions, options.BatchReadMode)
+	}
+	return nil
+}
+
+// checkImmutableOptions returns an error if an option that cannot be changed while the database is open differs
+func checkImmutableOptions(current *Options, options *Options) error {
+	changed := ""
+	switch {
+	case options.MemtableType != current.MemtableType:
+		changed = "MemtableType"
+	case options.BatchReadMode != current.BatchReadMode:
+		changed = "BatchReadMode"
+	case reflect.ValueOf(options.UserKeyCompare).Pointer() != reflect.ValueOf(current.UserKeyCompare).Pointer():
+		changed = "UserKeyCompare"
+	case options.UserKeyCompareName != current.UserKeyCompareName:
+		changed = "UserKeyCompareName"
+	case options.FileSystem != current.FileSystem:
+		changed = "FileSystem"
+	case options.InMemory != current.InMemory:
+		changed = "InMemory"
+	case options.ReadOnly != current.ReadOnly:
+		changed = "ReadOnly"
+	case options.WriteBufferManager != current.WriteBufferManager:
+		changed = "WriteBufferManager"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%w: %s cannot be changed while the database is open", InvalidOptions, changed)
+}
+
+const optionsFileName = "OPTIONS"
+const dbFormatVersion = 1
+const bytewiseCompareName = "bytewise"
+
+// LoadOptions reads the options that were persisted in the OPTIONS file of the database at path, so that the
+// database can be opened with its original configuration. The UserKeyCompare function cannot be persisted, so if
+// the database uses a custom key comparison, only UserKeyCompareName is set and the caller must provide the function.
+func LoadOptions(path string) (Options, error) {
+	return loadOptions(defaultFileSystem, filepath.Clean(path))
+}
+
+func loadOptions(fs FileSystem, path string) (Options, error) {
+	options := Options{}
+	values, err := readOptionsFile(fs, path)
+	if err != nil {
+		return options, err
+	}
+	for key, value := range values {
+		err = setOption(&options, key, value)
+		if err != nil {
+			return options, err
+		}
+	}
+	if options.UserKeyCompareName == bytewiseCompareName {
+		options.UserKeyCompareName = ""
+	}
+	return options, nil
+}
+
+// readOptionsFile returns the key value pairs of the OPTIONS file
+func readOptionsFile(fs FileSystem, path string) (map[string]string, error) {
+	f, err := fs.Open(filepath.Join(path, optionsFileName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	s := bufio.NewScanner(io.NewSectionReader(f, 0, int64(f.Len())))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid line in OPTIONS file '%s'", NotValidDatabase, line)
+		}
+		values[key] = value
+	}
+	return values, s.Err()
+}
+
+// setOption sets the option named key, unknown keys are ignored so that newer OPTIONS files can be read
+func setOption(options *Options, key string, value string) error {
+	var err error
+	switch key {
+	case "MaxSegments":
+		var n uint64
+		n, err = strconv.ParseUint(value, 10, 0)
+		options.MaxSegments = uint(n)
+	case "MaxMemoryBytes":
+		options.MaxMemoryBytes, err = strconv.ParseUint(value, 10, 64)
+	case "MaxImmutableMemtables":
+		options.MaxImmutableMemtables, err = strconv.Atoi(value)
+	case "DisableAutoMerge":
+		options.DisableAutoMerge, err = strconv.ParseBool(value)
+	case "DisableWriteFlush":
+		options.DisableWriteFlush, err = strconv.ParseBool(value)
+	case "EnableSyncWrite":
+		options.EnableSyncWrite, err = strconv.ParseBool(value)
+	case "DisableSegmentSync":
+		options.DisableSegmentSync, err = strconv.ParseBool(value)
+	case "MergeThrottle":
+		options.MergeThrottle, err = time.ParseDuration(value)
+	case "MemtableType":
+		var n int
+		n, err = strconv.Atoi(value)
+		options.MemtableType = memtableType(n)
+	case "BatchReadMode":
+		var n int
+		n, err = strconv.Atoi(value)
+		options.BatchReadMode = batchReadMode(n)
+	case "UserKeyCompareName":
+		options.UserKeyCompareName = value
+	}
+	if err != nil {
+		return fmt.Errorf("%w: invalid %s in OPTIONS file", NotValidDatabase, key)
+	}
+	return nil
+}
+
+// compareName returns the name of the key comparison recorded in the OPTIONS file, or an error if UserKeyCompare is
+// set without a name, since different unnamed comparisons could not be told apart
+func compareName(options *Options) (string, error) {
+	if options.UserKeyCompareName != "" {
+		return options.UserKeyCompareName, nil
+	}
+	if options.UserKeyCompare == nil {
+		return bytewiseCompareName, nil
+	}
+	return "", fmt.Errorf("%w: UserKeyCompareName is required with UserKeyCompare", InvalidOptions)
+}
+
+// hasOptionsFile returns true if the database at path has an OPTIONS file. A database created by an earlier version
+// does not, and one is not written, so that the earlier version can still open the database.
+func hasOptionsFile(fs FileSystem, path string) bool {
+	_, err := fs.Stat(filepath.Join(path, optionsFileName))
+	return err == nil
+}
+
+// checkOptionsFile returns an error if the database at path was created with options that are incompatible with
+// options, a missing OPTIONS file is compatible since it was created by an earlier version
+func checkOptionsFile(fs FileSystem, path string, options *Options) error {
+	values, err := readOptionsFile(fs, path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	compare, err := compareName(options)
+	if err != nil {
+		return err
+	}
+	if version := values["FormatVersion"]; version != strconv.Itoa(dbFormatVersion) {
+		return fmt.Errorf("%w: database format version %s is not supported", IncompatibleOptions, version)
+	}
+	if size := values["KeyBlockSize"]; size != strconv.Itoa(keyBlockSize) {
+		return fmt.Errorf("%w: database key block size %s is not supported", IncompatibleOptions, size)
+	}
+	if name := values["UserKeyCompareName"]; name != compare {
+		return fmt.Errorf("%w: database was created with key comparison '%s', not '%s'", IncompatibleOptions, name, compare)
+	}
+	return nil
+}
+
+// writeOptionsFile atomically replaces the OPTIONS file of the database at path
+func writeOptionsFile(fs FileSystem, path string, options *Options) error {
+	compare, err := compareName(options)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintln(&b, "# leveldb options, written when the database is created or opened, and by SetOptions")
+	fmt.Fprintln(&b, "FormatVersion="+strconv.Itoa(dbFormatVersion))
+	fmt.Fprintln(&b, "KeyBlockSize="+strconv.Itoa(keyBlockSize))
+	fmt.Fprintln(&b, "UserKeyCompareName="+compare)
+	fmt.Fprintln(&b, "MaxSegments="+fmt.Sprint(options.MaxSegments))
+	fmt.Fprintln(&b, "MaxMemoryBytes="+fmt.Sprint(options.MaxMemoryBytes))
+	fmt.Fprintln(&b, "MaxImmutableMemtables="+fmt.Sprint(options.MaxImmutableMemtables))
+	fmt.Fprintln(&b, "DisableAutoMerge="+fmt.Sprint(options.DisableAutoMerge))
+	fmt.Fprintln(&b, "DisableWriteFlush="+fmt.Sprint(options.DisableWriteFlush))
+	fmt.Fprintln(&b, "EnableSyncWrite="+fmt.Sprint(options.EnableSyncWrite))
+	fmt.Fprintln(&b, "DisableSegmentSync="+fmt.Sprint(options.DisableSegmentSync))
+	fmt.Fprintln(&b, "MergeThrottle="+options.MergeThrottle.String())
+	fmt.Fprintln(&b, "MemtableType="+fmt.Sprint(int(options.MemtableType)))
+	fmt.Fprintln(&b, "BatchReadMode="+fmt.Sprint(int(options.BatchReadMode)))
+
+	filename := filepath.Join(path, optionsFileName)
+	f, err := fs.Create(filename + ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, b.String())
+	if err == nil {
+		err = f.Sync()
+	}
+	err = errn(err, f.Close())
+	if err != nil {
+		return err
+	}
+	err = fs.Rename(filename+".tmp", filename)
+	if err != nil {
+		return err
+	}
+	return fs.SyncDir(path)
+}
@@ -0,0 +1,168 @@
+package leveldb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// number of times the segments are reloaded when the primary removes a file while the secondary is loading it
+const catchUpAttempts = 10
+
+// OpenSecondary opens a read-only secondary instance of a database that is open by another process, the primary.
+// The secondary does not take the lock, and reads the disk segments and logs of the primary as of the time it is
+// opened, use TryCatchUpWithPrimary to read the changes made since. Options.ReadOnly is implied.
+func OpenSecondary(path string, options Options) (*Database, error) {
+	global_lock.Lock()
+	defer global_lock.Unlock()
+
+	options.ReadOnly = true
+	return open(path, options, true)
+}
+
+// TryCatchUpWithPrimary reads the segments and log entries written by the primary since the secondary was opened
+// or last caught up. Open snapshots and iterators continue to read the segments as of their creation.
+func (db *Database) TryCatchUpWithPrimary() error {
+	if !db.secondary {
+		return fmt.Errorf("%w: not a secondary instance, see OpenSecondary", InvalidOptions)
+	}
+
+	db.Lock()
+	defer db.Unlock()
+
+	if !db.open {
+		return DatabaseClosed
+	}
+
+	state := db.getState()
+	segments, err := loadPrimarySegments(db.path, *db.getOptions(), state.segments)
+	if err != nil {
+		return err
+	}
+	db.setState(&dbState{segments: segments, memory: state.memory, multi: newMultiSegment(copyAndAppend(segments, state.memory))})
+	db.logger().Debug("caught up with primary", "segments", len(segments), "unflushed", unflushedSegments(segments))
+	return nil
+}
+
+// loadPrimarySegments loads the segments of the database at path, which is being modified by the primary. The
+// current segments are reused if their files have not changed. The load is retried if the primary removes a file,
+// since its contents have been written to a newer segment.
+func loadPrimarySegments(path string, options Options, current []segment) ([]segment, error) {
+	for attempt := 1; ; attempt++ {
+		segments, err := loadPrimarySegments0(path, options, current)
+		if err == nil || !errors.Is(err, os.ErrNotExist) || attempt == catchUpAttempts {
+			return segments, err
+		}
+	}
+}
+
+func loadPrimarySegments0(path string, options Options, current []segment) ([]segment, error) {
+	fs := options.fs()
+	files, err := fs.List(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// segments being written by the primary
+	incomplete := map[string]bool{}
+	for _, file := range files {
+		if strings.HasSuffix(file, ".tmp") {
+			base := strings.TrimSuffix(file, ".tmp")
+			incomplete[strings.TrimPrefix(strings.TrimPrefix(base, "keys."), "data.")] = true
+		}
+	}
+
+	loaded := make(map[string]segment, len(current))
+	for _, s := range current {
+		loaded[s.files()[0]] = s
+	}
+
+	segments := []segment{}
+	// the newly loaded segments, which are closed if they are not used
+	opened := []segment{}
+
+	for _, file := range files {
+		filename := filepath.Join(path, file)
+		switch {
+		case strings.HasPrefix(file, "log."):
+			// the primary appends to its current log file
+			if ls, ok := loaded[file].(*logSegment); ok {
+				info, err := fs.Stat(filename)
+				if err != nil {
+					closeSegments(opened)
+					return nil, err
+				}
+				if uint64(info.Size()) == ls.filesize {
+					segments = append(segments, ls)
+					continue
+				}
+				if uint64(info.Size()) > ls.filesize {
+					// only read the entries appended since
+					tailed, err := ls.tail()
+					if err != nil {
+						closeSegments(opened)
+						return nil, err
+					}
+					segments = append(segments, tailed)
+					opened = append(opened, tailed)
+					continue
+				}
+			}
+			ls, err := newLogSegment(filename, options, true)
+			if err != nil {
+				closeSegments(opened)
+				return nil, err
+			}
+			segments = append(segments, ls)
+			opened = append(opened, ls)
+		case strings.HasPrefix(file, "keys.") && !strings.HasSuffix(file, ".tmp") && !incomplete[strings.TrimPrefix(file, "keys.")]:
+			// disk segments are immutable
+			if s, ok := loaded[file]; ok {
+				segments = append(segments, s)
+				continue
+			}
+			lowerId, upperId, err := getSegmentIDs(filename)
+			if err != nil {
+				closeSegments(opened)
+				return nil, err
+			}
+			dataFilename := filepath.Join(path, fmt.Sprintf("data.%d.%d", lowerId, upperId))
+			ds, err := newDiskSegment(fs, filename, dataFilename, nil)
+			if err != nil {
+				closeSegments(opened)
+				return nil, err
+			}
+			segments = append(segments, ds)
+			opened = append(opened, ds)
+		}
+	}
+
+	segments = orderSegments(segments, func(seg, containedIn segment) {})
+
+	used := make(map[segment]bool, len(segments))
+	for _, s := range segments {
+		used[s] = true
+	}
+	for _, s := range opened {
+		if !used[s] {
+			s.Close()
+		}
+	}
+	for _, s := range current {
+		if !used[s] {
+			closeOnFinalize(s)
+		}
+	}
+	return segments, nil
+}
+
+// closeOnFinalize closes a segment that was removed by the primary once it is no longer referenced by a snapshot
+// or iterator of the secondary
+func closeOnFinalize(s segment) {
+	if ds, ok := s.(*diskSegment); ok {
+		runtime.SetFinalizer(ds, func(ds *diskSegment) { ds.Close() })
+	}
+}
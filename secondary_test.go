@@ -0,0 +1,190 @@
+package leveldb
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSecondary(t *testing.T) {
+	fs := NewMemFileSystem()
+	options := Options{CreateIfNeeded: true, DisableAutoMerge: true, FileSystem: fs}
+
+	db, err := Open("test/primarydb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	defer db.Close()
+	if !errors.Is(db.TryCatchUpWithPrimary(), InvalidOptions) {
+		t.Fatal("catch up should fail on a primary")
+	}
+	put := func(i int) {
+		err := db.Put([]byte(fmt.Sprint("mykey", i)), []byte(fmt.Sprint("myvalue", i)))
+		if err != nil {
+			t.Fatal("unable to put key/value", err)
+		}
+	}
+	// checks that the keys up to n are visible to the secondary
+	check := func(secondary *Database, n int) {
+		for i := 0; i < n; i++ {
+			value, err := secondary.Get([]byte(fmt.Sprint("mykey", i)))
+			if err != nil || string(value) != fmt.Sprint("myvalue", i) {
+				t.Fatal("incorrect value", i, string(value), err)
+			}
+		}
+		_, err := secondary.Get([]byte(fmt.Sprint("mykey", n)))
+		if err != KeyNotFound {
+			t.Fatal("key should not be visible", n, err)
+		}
+	}
+	put(0)
+
+	secondary, err := OpenSecondary("test/primarydb", Options{FileSystem: fs})
+	if err != nil {
+		t.Fatal("unable to open secondary", err)
+	}
+	defer secondary.Close()
+	check(secondary, 1)
+	if err = secondary.Put([]byte("mykey"), []byte("myvalue")); err != DatabaseReadOnly {
+		t.Fatal("put should fail on a secondary", err)
+	}
+
+	// new log entries
+	put(1)
+	check(secondary, 1)
+	snapshot, err := secondary.Snapshot()
+	if err != nil {
+		t.Fatal("unable to create snapshot", err)
+	}
+	err = secondary.TryCatchUpWithPrimary()
+	if err != nil {
+		t.Fatal("unable to catch up", err)
+	}
+	check(secondary, 2)
+	if _, err = snapshot.Get([]byte("mykey1")); err != KeyNotFound {
+		t.Fatal("snapshot should not see the new key", err)
+	}
+	snapshot.Close()
+
+	// flushed segments, and a new log
+	for i := 2; i < 4; i++ {
+		put(i)
+		err = db.flushMemory()
+		if err != nil {
+			t.Fatal("unable to flush memory", err)
+		}
+		waitForFlush(t, db)
+	}
+	put(4)
+	err = secondary.TryCatchUpWithPrimary()
+	if err != nil {
+		t.Fatal("unable to catch up", err)
+	}
+	check(secondary, 5)
+	if stats := secondary.Stats(); stats.DiskSegments != 2 || stats.LogSegments != 1 {
+		t.Fatal("incorrect segments", stats.DiskSegments, stats.LogSegments)
+	}
+
+	// merged segments
+	err = mergeSegments0(db, 1, false)
+	if err != nil {
+		t.Fatal("unable to merge", err)
+	}
+	err = secondary.TryCatchUpWithPrimary()
+	if err != nil {
+		t.Fatal("unable to catch up", err)
+	}
+	check(secondary, 5)
+	if stats := secondary.Stats(); stats.DiskSegments != 1 || stats.LogSegments != 1 {
+		t.Fatal("incorrect segments after merge", stats.DiskSegments, stats.LogSegments)
+	}
+
+	err = secondary.Close()
+	if err != nil {
+		t.Fatal("unable to close secondary", err)
+	}
+	if err = secondary.TryCatchUpWithPrimary(); err != DatabaseClosed {
+		t.Fatal("catch up should fail after close", err)
+	}
+}
+
+func TestSecondary_LogTail(t *testing.T) {
+	fs := NewMemFileSystem()
+	options := Options{CreateIfNeeded: true, DisableAutoMerge: true, FileSystem: fs}
+
+	db, err := Open("test/primarydb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	defer db.Close()
+	err = db.Put([]byte("mykey0"), []byte("myvalue0"))
+	if err != nil {
+		t.Fatal("unable to put key/value", err)
+	}
+
+	secondary, err := OpenSecondary("test/primarydb", Options{FileSystem: fs})
+	if err != nil {
+		t.Fatal("unable to open secondary", err)
+	}
+	defer secondary.Close()
+
+	n := 2 * maxLogTailDepth
+	for i := 1; i <= n; i++ {
+		err = db.Put([]byte(fmt.Sprint("mykey", i)), []byte(fmt.Sprint("myvalue", i)))
+		if err != nil {
+			t.Fatal("unable to put key/value", err)
+		}
+		if i == n {
+			_, err = db.Remove([]byte("mykey0"))
+			if err != nil {
+				t.Fatal("unable to remove key", err)
+			}
+		}
+		snapshot, err := secondary.Snapshot()
+		if err != nil {
+			t.Fatal("unable to create snapshot", err)
+		}
+		err = secondary.TryCatchUpWithPrimary()
+		if err != nil {
+			t.Fatal("unable to catch up", err)
+		}
+		// only the new entries of the log are read, until the log is replayed to limit the chain of segments
+		segments := secondary.getState().segments
+		ls, ok := segments[len(segments)-1].(*logSegment)
+		if !ok || ls.depth != i%(maxLogTailDepth+1) {
+			t.Fatal("log should have been tailed", i, segments)
+		}
+		value, err := secondary.Get([]byte(fmt.Sprint("mykey", i)))
+		if err != nil || string(value) != fmt.Sprint("myvalue", i) {
+			t.Fatal("incorrect value", i, string(value), err)
+		}
+		if _, err = snapshot.Get([]byte(fmt.Sprint("mykey", i))); err != KeyNotFound {
+			t.Fatal("snapshot should not see the new key", i, err)
+		}
+		snapshot.Close()
+	}
+
+	if _, err = secondary.Get([]byte("mykey0")); err != KeyNotFound {
+		t.Fatal("removed key should not be found", err)
+	}
+	itr, err := secondary.Lookup(nil, nil)
+	if err != nil {
+		t.Fatal("unable to lookup", err)
+	}
+	count := 0
+	for {
+		_, value, err := itr.Next()
+		if err == EndOfIterator {
+			break
+		}
+		if err != nil {
+			t.Fatal("unable to iterate", err)
+		}
+		if len(value) > 0 {
+			count++
+		}
+	}
+	if count != n {
+		t.Fatal("incorrect number of keys", count)
+	}
+}
@@ -3,15 +3,23 @@ package leveldb
 // segment represents a portion(s) of the database, which is a "database" in and unto itself
 // some operations are not supported on some segment types, as some are read-only
 type segment interface {
-	Put(key []byte, value []byte) ([]byte, error)
+	Put(key []byte, value []byte) error
 	Get(key []byte) ([]byte, error)
-	Remove(key []byte) ([]byte, error)
+	// GetUnsafe is the same as Get but the value may refer to memory owned by the segment, and is only
+	// valid until the segment is closed
+	GetUnsafe(key []byte) ([]byte, error)
+	Remove(key []byte) error
 	Lookup(lower []byte, upper []byte) (LookupIterator, error)
+	// LookupKeys is the same as Lookup but values may not be read, use valueSize() on the iterator
+	LookupKeys(lower []byte, upper []byte) (LookupIterator, error)
+	// LookupUnsafe is the same as Lookup but values may refer to memory owned by the segment, see GetUnsafe
+	LookupUnsafe(lower []byte, upper []byte) (LookupIterator, error)
 	Close() error
 	LowerID() uint64
 	UpperID() uint64
 	removeSegment() error
-	removeOnFinalize()
+	// removeOnFinalize calls remove with the segment once it is no longer referenced
+	removeOnFinalize(remove func(s segment))
 	files() []string
 	size() uint64
 }
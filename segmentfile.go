@@ -0,0 +1,93 @@
+package leveldb
+
+import (
+	"io"
+	"sync"
+)
+
+// segmentFile is an immutable segment file opened for reading via the FileSystem
+type segmentFile struct {
+	file   RandomAccessFile
+	length int
+	name   string
+	// the contents of the file if the FileSystem holds them in memory, see mappedFile
+	data []byte
+}
+
+// mappedFile is implemented by a RandomAccessFile that holds the file contents in memory, so that the key blocks
+// can be read without copying them, or passing a buffer through the RandomAccessFile interface, which would move
+// the buffer to the heap.
+type mappedFile interface {
+	// contents returns the file contents, which are only valid until Close
+	contents() []byte
+}
+
+// blockPool holds the buffers used to read key blocks from files that are not held in memory, a buffer passed
+// through the RandomAccessFile interface would otherwise move to the heap on every read
+var blockPool = sync.Pool{New: func() any {
+	buffer := make([]byte, keyBlockSize)
+	return &buffer
+}}
+
+func newSegmentFile(fs FileSystem, filename string) (*segmentFile, error) {
+	f := segmentFile{}
+	file, err := fs.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	f.file = file
+	f.length = file.Len()
+	f.name = filename
+	if mf, ok := file.(mappedFile); ok {
+		f.data = mf.contents()
+	}
+	return &f, nil
+}
+
+func (f *segmentFile) Length() int64 {
+	return int64(f.length)
+}
+
+func (f *segmentFile) ReadAt(buffer []byte, off int64) (int, error) {
+	return f.file.ReadAt(buffer, off)
+}
+
+// readBlock returns length bytes at off, which must be at most keyBlockSize. If the file is held in memory the
+// bytes refer directly to it, otherwise they are read into a pooled buffer, which is returned and must be released
+// with releaseBlock once the bytes are no longer used.
+func (f *segmentFile) readBlock(off int64, length int) ([]byte, *[]byte, error) {
+	if f.data != nil {
+		if off < 0 || off+int64(length) > int64(len(f.data)) {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		return f.data[off : off+int64(length)], nil, nil
+	}
+	buffer := blockPool.Get().(*[]byte)
+	_, err := f.file.ReadAt((*buffer)[:length], off)
+	if err != nil {
+		releaseBlock(buffer)
+		return nil, nil, err
+	}
+	return (*buffer)[:length], buffer, nil
+}
+
+// releaseBlock returns a buffer returned by readBlock to the pool, buffer may be nil
+func releaseBlock(buffer *[]byte) {
+	if buffer != nil {
+		blockPool.Put(buffer)
+	}
+}
+
+// Slice returns the bytes at off without copying where possible, the slice is only valid until the file is closed
+func (f *segmentFile) Slice(off int64, length int) ([]byte, error) {
+	return f.file.Slice(off, length)
+}
+
+func (f *segmentFile) Close() error {
+	f.data = nil
+	return f.file.Close()
+}
+
+func (f *segmentFile) Name() string {
+	return f.name
+}
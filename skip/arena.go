@@ -0,0 +1,84 @@
+package skip
+
+import (
+	"sync"
+	"unsafe"
+)
+
+const defaultArenaBlockSize = 1024 * 1024
+
+// Arena allocates the nodes of a SkipList, and optionally byte slices for the keys, from large blocks. This reduces
+// the number of objects tracked by the garbage collector for large lists, and the byte blocks are not scanned at all.
+// A block is released only when nothing allocated from it is reachable. An Arena is safe for concurrent use.
+type Arena[K any] struct {
+	mu        sync.Mutex
+	blockSize int
+	nodes     []node[K]
+	pointers  []*node[K]
+	bytes     []byte
+	size      int64
+}
+
+// NewArena returns an Arena that allocates blocks of blockSize bytes, or 1MB if blockSize is <= 0
+func NewArena[K any](blockSize int) *Arena[K] {
+	if blockSize <= 0 {
+		blockSize = defaultArenaBlockSize
+	}
+	return &Arena[K]{blockSize: blockSize}
+}
+
+func (a *Arena[K]) newNode(height int) *node[K] {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.nodes) == 0 {
+		size := int(unsafe.Sizeof(node[K]{}))
+		n := a.blockSize / size
+		if n < 1 {
+			n = 1
+		}
+		a.nodes = make([]node[K], n)
+		a.size += int64(n * size)
+	}
+	x := &a.nodes[0]
+	a.nodes = a.nodes[1:]
+
+	if len(a.pointers) < height {
+		size := int(unsafe.Sizeof(x))
+		n := a.blockSize / size
+		if n < kMaxHeight {
+			n = kMaxHeight
+		}
+		a.pointers = make([]*node[K], n)
+		a.size += int64(n * size)
+	}
+	x.next_ = a.pointers[:height:height]
+	a.pointers = a.pointers[height:]
+	return x
+}
+
+// Bytes returns a slice of length n allocated from the arena. Slices larger than a quarter of the block size are
+// allocated separately, to limit the space wasted at the end of each block.
+func (a *Arena[K]) Bytes(n int) []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if n > a.blockSize/4 {
+		a.size += int64(n)
+		return make([]byte, n)
+	}
+	if len(a.bytes) < n {
+		a.bytes = make([]byte, a.blockSize)
+		a.size += int64(a.blockSize)
+	}
+	b := a.bytes[:n:n]
+	a.bytes = a.bytes[n:]
+	return b
+}
+
+// Size returns the number of bytes allocated by the arena, including the unused space in the current blocks
+func (a *Arena[K]) Size() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.size
+}
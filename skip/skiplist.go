@@ -9,16 +9,20 @@ import (
 const kMaxHeight = 12
 
 // SkipList is a high performance data structure based on the Google LevelDB implementation.
-// Mutating operations must be externally synchronized, but reads including
-// iteration are lock-free.
+// Put, Remove and Delete must be externally synchronized, but reads including iteration are lock-free.
+// PutConcurrently may be called concurrently with other calls to PutConcurrently and with readers.
 type SkipList[K any] struct {
 	cmp_       func(K, K) int
 	head_      *node[K]
 	maxHeight_ int32
 	random_    rand.Rand
+	arena_     *Arena[K]
+	// number of keys and bytes used by the nodes, atomically updated
+	length_ int64
+	memory_ int64
 }
 
-// Put must be externally synchronized with Remove.
+// Put must be externally synchronized with Remove and Delete.
 func (s *SkipList[K]) Put(key K) K {
 	// TODO(opt): We can use a barrier-free variant of FindGreaterOrEqual()
 	// here since Put() is externally synchronized.
@@ -27,10 +31,10 @@ func (s *SkipList[K]) Put(key K) K {
 	x := s.findGreaterOrEqual(key, prev[:])
 
 	// we don't support sequence numbers yet, so if key matches update
-	if x != nil && s.equal(x.key, key) {
-		old := x.key
-		x.key = key
-		return old
+	if x != nil && s.equal(x.key(), key) {
+		old := x.entry.Load()
+		x.entry.Store(&entry[K]{key: key, seq: old.seq})
+		return old.key
 	}
 
 	height := s.randomHeight()
@@ -48,7 +52,8 @@ func (s *SkipList[K]) Put(key K) K {
 		atomic.StoreInt32(&s.maxHeight_, int32(height))
 	}
 
-	x = newNode(key, height)
+	x = s.newNode(key, 0, height)
+	s.added(height)
 	for i := 0; i < height; i++ {
 		// NoBarrier_SetNext() suffices since we will add a barrier when
 		// we publish a pointer to "x" in prev[i].
@@ -59,8 +64,96 @@ func (s *SkipList[K]) Put(key K) K {
 	return noop
 }
 
-func newNode[K any](key K, height int) *node[K] {
-	return &node[K]{key: key, next_: make([]*node[K], height)}
+// PutConcurrently inserts the key using compare-and-swap, and may be called concurrently with other calls to
+// PutConcurrently and with readers, but must be externally synchronized with Put, Remove and Delete. If the key
+// exists, it is replaced only if seq is greater than the seq of the existing key, so that the order of concurrent
+// updates is determined by the caller. It returns the replaced key, and false if the key was not applied
+// because the existing key is newer.
+func (s *SkipList[K]) PutConcurrently(key K, seq uint64) (K, bool) {
+	height := s.randomHeight()
+	maxHeight := s.getMaxHeight()
+	for height > maxHeight {
+		if atomic.CompareAndSwapInt32(&s.maxHeight_, int32(maxHeight), int32(height)) {
+			maxHeight = height
+			break
+		}
+		maxHeight = s.getMaxHeight()
+	}
+
+	var prev, next [kMaxHeight]*node[K]
+	x := s.head_
+	for level := maxHeight - 1; level >= 0; level-- {
+		prev[level], next[level] = s.findSpliceForLevel(key, x, level)
+		x = prev[level]
+	}
+	if next[0] != nil && s.equal(next[0].key(), key) {
+		return next[0].update(key, seq)
+	}
+
+	x = s.newNode(key, seq, height)
+	for i := 0; i < height; i++ {
+		for {
+			x.setNext(i, next[i])
+			if prev[i].casNext(i, next[i], x) {
+				break
+			}
+			// another node was inserted after prev, so find the new splice at this level
+			prev[i], next[i] = s.findSpliceForLevel(key, prev[i], i)
+			if i == 0 && next[0] != nil && s.equal(next[0].key(), key) {
+				// the same key was inserted concurrently, and x is not yet reachable
+				return next[0].update(key, seq)
+			}
+		}
+	}
+	s.added(height)
+	var noop K
+	return noop, true
+}
+
+// findSpliceForLevel returns the last node before key and the node after it at level, starting from before
+func (s *SkipList[K]) findSpliceForLevel(key K, before *node[K], level int) (*node[K], *node[K]) {
+	for {
+		next := before.next(level)
+		if !s.keyIsAfterNode(key, next) {
+			return before, next
+		}
+		before = next
+	}
+}
+
+func (s *SkipList[K]) newNode(key K, seq uint64, height int) *node[K] {
+	var n *node[K]
+	if s.arena_ != nil {
+		n = s.arena_.newNode(height)
+	} else {
+		n = &node[K]{next_: make([]*node[K], height)}
+	}
+	n.inline = entry[K]{key: key, seq: seq}
+	n.entry.Store(&n.inline)
+	return n
+}
+
+// added updates the length and memory usage for a node of height that was linked into the list
+func (s *SkipList[K]) added(height int) {
+	atomic.AddInt64(&s.length_, 1)
+	atomic.AddInt64(&s.memory_, nodeSize[K](height))
+}
+
+// nodeSize returns the number of bytes used by a node of height
+func nodeSize[K any](height int) int64 {
+	var p *node[K]
+	return int64(unsafe.Sizeof(node[K]{})) + int64(height)*int64(unsafe.Sizeof(p))
+}
+
+// Len returns the number of keys in the list
+func (s *SkipList[K]) Len() int {
+	return int(atomic.LoadInt64(&s.length_))
+}
+
+// MemoryUsage returns the number of bytes used by the nodes of the list, which does not include memory
+// referenced by the keys
+func (s *SkipList[K]) MemoryUsage() int64 {
+	return atomic.LoadInt64(&s.memory_)
 }
 
 const kBranching = 4
@@ -76,30 +169,78 @@ func (s *SkipList[K]) randomHeight() int {
 
 func (s *SkipList[K]) Get(key K) (K, bool) {
 	x := s.findGreaterOrEqual(key, nil)
-	if x != nil && s.equal(key, x.key) {
-		return x.key, true
-	} else {
-		var noop K
-		return noop, false
+	if x != nil {
+		if k := x.key(); s.equal(key, k) {
+			return k, true
+		}
 	}
+	var noop K
+	return noop, false
 }
 
-// Remove must be externally synchronized with Put.
+// Remove replaces an existing key with key, so that the caller can store a tombstone which is visible to readers
+// and iterators. The node is not unlinked, see Delete. Remove must be externally synchronized with Put and Delete.
 func (s *SkipList[K]) Remove(key K) (K, bool) {
 	x := s.findGreaterOrEqual(key, nil)
-	if x != nil && s.equal(key, x.key) {
-		prev := x.key
-		x.key = key
-		return prev, true
+	if x != nil && s.equal(key, x.key()) {
+		prev := x.entry.Load()
+		x.entry.Store(&entry[K]{key: key, seq: prev.seq})
+		return prev.key, true
 	} else {
 		var noop K
 		return noop, false
 	}
 }
 
+// Delete unlinks the node for key from the list, and returns the deleted key. Iterators positioned on the node can
+// still advance, but new searches will not find it. Delete must be externally synchronized with Put,
+// PutConcurrently and Remove.
+func (s *SkipList[K]) Delete(key K) (K, bool) {
+	var prev [kMaxHeight]*node[K]
+
+	x := s.findGreaterOrEqual(key, prev[:])
+	if x == nil || !s.equal(key, x.key()) {
+		var noop K
+		return noop, false
+	}
+	for i := len(x.next_) - 1; i >= 0; i-- {
+		prev[i].setNext(i, x.next(i))
+	}
+	atomic.AddInt64(&s.length_, -1)
+	atomic.AddInt64(&s.memory_, -nodeSize[K](len(x.next_)))
+	return x.key(), true
+}
+
+// entry is the key stored in a node, and the seq of the PutConcurrently that stored it
+type entry[K any] struct {
+	key K
+	seq uint64
+}
+
+// node keys are replaced atomically, so the entry normally points to the inline entry to avoid an allocation
 type node[K any] struct {
-	key   K
-	next_ []*node[K]
+	entry  atomic.Pointer[entry[K]]
+	inline entry[K]
+	next_  []*node[K]
+}
+
+func (node_ *node[K]) key() K {
+	return node_.entry.Load().key
+}
+
+// update replaces the key if seq is greater than the seq of the current key
+func (node_ *node[K]) update(key K, seq uint64) (K, bool) {
+	e := &entry[K]{key: key, seq: seq}
+	for {
+		old := node_.entry.Load()
+		if old.seq > seq {
+			var noop K
+			return noop, false
+		}
+		if node_.entry.CompareAndSwap(old, e) {
+			return old.key, true
+		}
+	}
 }
 
 func (node_ *node[K]) next(n int) *node[K] {
@@ -112,6 +253,11 @@ func (node_ *node[K]) setNext(n int, x *node[K]) {
 	atomic.StorePointer(p, unsafe.Pointer(x))
 }
 
+func (node_ *node[K]) casNext(n int, old *node[K], x *node[K]) bool {
+	p := (*unsafe.Pointer)(unsafe.Pointer(&node_.next_[n]))
+	return atomic.CompareAndSwapPointer(p, unsafe.Pointer(old), unsafe.Pointer(x))
+}
+
 type Iterator[K any] struct {
 	list_ *SkipList[K]
 	node_ *node[K]
@@ -125,16 +271,26 @@ func (i *Iterator[K]) Next() {
 	i.node_ = i.node_.next(0)
 }
 
+// Prev moves to the previous key. Nodes only link forward, so this requires a search from the head of the list.
+func (i *Iterator[K]) Prev() {
+	i.node_ = i.list_.findLessThan(i.node_.key())
+}
+
 func (i *Iterator[K]) SeekToFirst() {
 	i.node_ = i.list_.head_.next(0)
 }
 
+// SeekToLast moves to the last key, the iterator is not valid if the list is empty
+func (i *Iterator[K]) SeekToLast() {
+	i.node_ = i.list_.findLast()
+}
+
 func (i *Iterator[K]) Seek(target K) {
 	i.node_ = i.list_.findGreaterOrEqual(target, nil)
 }
 
 func (i *Iterator[K]) Key() K {
-	return i.node_.key
+	return i.node_.key()
 }
 
 func (s *SkipList[K]) Iterator() Iterator[K] {
@@ -143,7 +299,7 @@ func (s *SkipList[K]) Iterator() Iterator[K] {
 
 func (s *SkipList[K]) Contains(key K) bool {
 	x := s.findGreaterOrEqual(key, nil)
-	if x != nil && s.equal(key, x.key) {
+	if x != nil && s.equal(key, x.key()) {
 		return true
 	} else {
 		return false
@@ -172,9 +328,49 @@ func (s *SkipList[K]) findGreaterOrEqual(key K, prev []*node[K]) *node[K] {
 	}
 }
 
+// findLessThan returns the last node with a key less than key, or nil if there is none
+func (s *SkipList[K]) findLessThan(key K) *node[K] {
+	x := s.head_
+	level := s.getMaxHeight() - 1
+	for {
+		next := x.next(level)
+		if s.keyIsAfterNode(key, next) {
+			x = next
+		} else if level == 0 {
+			break
+		} else {
+			level--
+		}
+	}
+	if x == s.head_ {
+		return nil
+	}
+	return x
+}
+
+// findLast returns the last node, or nil if the list is empty
+func (s *SkipList[K]) findLast() *node[K] {
+	x := s.head_
+	level := s.getMaxHeight() - 1
+	for {
+		next := x.next(level)
+		if next != nil {
+			x = next
+		} else if level == 0 {
+			break
+		} else {
+			level--
+		}
+	}
+	if x == s.head_ {
+		return nil
+	}
+	return x
+}
+
 func (s *SkipList[K]) keyIsAfterNode(key K, n *node[K]) bool {
 	// null n is considered infinite
-	return (n != nil) && (s.cmp_(n.key, key) < 0)
+	return (n != nil) && (s.cmp_(n.key(), key) < 0)
 }
 
 func (s *SkipList[K]) getMaxHeight() int {
@@ -186,9 +382,15 @@ func (s *SkipList[K]) equal(a K, b K) bool {
 }
 
 func NewSkipList[K any](cmp func(K, K) int) SkipList[K] {
+	return NewArenaSkipList[K](cmp, nil)
+}
+
+// NewArenaSkipList returns a SkipList that allocates its nodes from arena, or from the heap if arena is nil
+func NewArenaSkipList[K any](cmp func(K, K) int, arena *Arena[K]) SkipList[K] {
 	var noop K
 
-	s := SkipList[K]{cmp_: cmp, head_: newNode[K](noop, kMaxHeight), maxHeight_: 1}
+	s := SkipList[K]{cmp_: cmp, maxHeight_: 1, arena_: arena}
+	s.head_ = s.newNode(noop, 0, kMaxHeight)
 
 	for i := 0; i < kMaxHeight; i++ {
 		s.head_.setNext(i, nil)
@@ -1,6 +1,10 @@
 package skip
 
-import "testing"
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
 
 func compare(a int64, b int64) int {
 	return int(a - b)
@@ -27,3 +31,157 @@ func BenchmarkSkipList_insert(b *testing.B) {
 		s.Put(int64(i))
 	}
 }
+
+func TestSkipList_PutConcurrently(t *testing.T) {
+	s := NewSkipList(compare)
+	const nwriters, n = 8, 10000
+	var wg sync.WaitGroup
+	for w := 0; w < nwriters; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < n; i += nwriters {
+				s.PutConcurrently(int64(i), 0)
+			}
+		}(w)
+	}
+	wg.Wait()
+	itr := s.Iterator()
+	itr.SeekToFirst()
+	count := 0
+	for ; itr.Valid(); itr.Next() {
+		if itr.Key() != int64(count) {
+			t.Fatal("incorrect key", itr.Key(), count)
+		}
+		count++
+	}
+	if count != n {
+		t.Fatal("incorrect count", count)
+	}
+}
+
+func TestSkipList_PutConcurrentlySeq(t *testing.T) {
+	type kv struct{ key, value int64 }
+	s := NewSkipList(func(a, b kv) int { return compare(a.key, b.key) })
+	s.PutConcurrently(kv{1, 2}, 2)
+	if _, ok := s.PutConcurrently(kv{1, 1}, 1); ok {
+		t.Fatal("older key should not be applied")
+	}
+	if prev, ok := s.PutConcurrently(kv{1, 3}, 3); !ok || prev.value != 2 {
+		t.Fatal("newer key should be applied", prev)
+	}
+	if k, _ := s.Get(kv{key: 1}); k.value != 3 {
+		t.Fatal("incorrect value", k)
+	}
+}
+
+func BenchmarkSkipList_insertConcurrently(b *testing.B) {
+	s := NewSkipList(compare)
+	var i int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.PutConcurrently(atomic.AddInt64(&i, 1), 0)
+		}
+	})
+}
+
+func TestSkipList_Delete(t *testing.T) {
+	s := NewSkipList(compare)
+	for i := int64(0); i < 100; i++ {
+		s.Put(i)
+	}
+	if s.Len() != 100 {
+		t.Fatal("incorrect length", s.Len())
+	}
+	memory := s.MemoryUsage()
+	for i := int64(0); i < 100; i += 2 {
+		if _, ok := s.Delete(i); !ok {
+			t.Fatal("key not deleted", i)
+		}
+	}
+	if _, ok := s.Delete(0); ok {
+		t.Fatal("key should already be deleted")
+	}
+	if s.Len() != 50 || s.MemoryUsage() >= memory {
+		t.Fatal("incorrect length or memory usage", s.Len(), s.MemoryUsage(), memory)
+	}
+	itr := s.Iterator()
+	count := 0
+	for itr.SeekToFirst(); itr.Valid(); itr.Next() {
+		if itr.Key()%2 == 0 {
+			t.Fatal("deleted key found", itr.Key())
+		}
+		count++
+	}
+	if count != 50 || s.Contains(10) || !s.Contains(11) {
+		t.Fatal("incorrect keys after delete", count)
+	}
+}
+
+func TestSkipList_Prev(t *testing.T) {
+	s := NewSkipList(compare)
+	itr := s.Iterator()
+	itr.SeekToLast()
+	if itr.Valid() {
+		t.Fatal("empty list should not be valid")
+	}
+	for i := int64(0); i < 1000; i++ {
+		s.Put(i)
+	}
+	count := int64(999)
+	for itr.SeekToLast(); itr.Valid(); itr.Prev() {
+		if itr.Key() != count {
+			t.Fatal("incorrect key", itr.Key(), count)
+		}
+		count--
+	}
+	if count != -1 {
+		t.Fatal("incorrect count", count)
+	}
+	itr.Seek(500)
+	itr.Prev()
+	if !itr.Valid() || itr.Key() != 499 {
+		t.Fatal("incorrect key after seek")
+	}
+}
+
+func TestSkipList_Arena(t *testing.T) {
+	arena := NewArena[int64](4096)
+	s := NewArenaSkipList(compare, arena)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < 10000; i += 4 {
+				s.PutConcurrently(int64(i), 0)
+			}
+		}(w)
+	}
+	wg.Wait()
+	if s.Len() != 10000 {
+		t.Fatal("incorrect length", s.Len())
+	}
+	if arena.Size() < s.MemoryUsage() {
+		t.Fatal("arena is smaller than the nodes", arena.Size(), s.MemoryUsage())
+	}
+	itr := s.Iterator()
+	count := int64(0)
+	for itr.SeekToFirst(); itr.Valid(); itr.Next() {
+		if itr.Key() != count {
+			t.Fatal("incorrect key", itr.Key(), count)
+		}
+		count++
+	}
+	b := arena.Bytes(100)
+	if len(b) != 100 || cap(b) != 100 {
+		t.Fatal("incorrect slice", len(b), cap(b))
+	}
+}
+
+func BenchmarkSkipList_insertArena(b *testing.B) {
+	s := NewArenaSkipList(compare, NewArena[int64](0))
+	for i := 0; i < b.N; i++ {
+		s.Put(int64(i))
+	}
+}
@@ -21,6 +21,23 @@ func (s *Snapshot) Get(key []byte) ([]byte, error) {
 	return value, nil
 }
 
+// GetUnsafe is the same as Get but avoids copying the value. The returned value may refer directly to a memory
+// mapped segment file, so it must not be modified, and is only valid until the Snapshot is closed. The Snapshot must
+// remain reachable while the value is in use, since it keeps the segment files mapped.
+func (s *Snapshot) GetUnsafe(key []byte) ([]byte, error) {
+	if s.multi == nil {
+		return nil, SnapshotClosed
+	}
+	value, err := s.multi.GetUnsafe(key)
+	if err != nil {
+		return nil, err
+	}
+	if value != nil && len(value) == 0 {
+		return nil, KeyNotFound
+	}
+	return value, nil
+}
+
 func (s *Snapshot) Lookup(lower []byte, upper []byte) (LookupIterator, error) {
 	if s.multi == nil {
 		return nil, SnapshotClosed
@@ -32,6 +49,30 @@ func (s *Snapshot) Lookup(lower []byte, upper []byte) (LookupIterator, error) {
 	return &dbLookup{LookupIterator: itr, db: s.db}, nil
 }
 
+// LookupUnsafe is the same as Lookup but avoids copying the values, with the same restrictions as GetUnsafe.
+func (s *Snapshot) LookupUnsafe(lower []byte, upper []byte) (LookupIterator, error) {
+	if s.multi == nil {
+		return nil, SnapshotClosed
+	}
+	itr, err := s.multi.LookupUnsafe(lower, upper)
+	if err != nil {
+		return nil, err
+	}
+	return &dbLookup{LookupIterator: itr, db: s.db}, nil
+}
+
+// LookupKeys is the same as Lookup but only the keys are returned, the values are not read.
+func (s *Snapshot) LookupKeys(lower []byte, upper []byte) (KeyIterator, error) {
+	if s.multi == nil {
+		return nil, SnapshotClosed
+	}
+	itr, err := s.multi.LookupKeys(lower, upper)
+	if err != nil {
+		return nil, err
+	}
+	return &dbKeyLookup{itr: &dbLookup{LookupIterator: itr, db: s.db}}, nil
+}
+
 // Close frees any resources used by the Snapshot. This is optional and instead simply setting the Snapshot reference
 // to nil will eventually free the resources.
 func (s *Snapshot) Close() {
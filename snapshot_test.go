@@ -153,3 +153,118 @@ func TestSnapshot_Close(t *testing.T) {
 
 	db.Close()
 }
+
+func TestSnapshot_Unsafe(t *testing.T) {
+	leveldb.Remove("test/mydb")
+
+	db, err := leveldb.Open("test/mydb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	err = db.Put([]byte("mykey"), []byte("myvalue"))
+	if err != nil {
+		t.Fatal("unable to put key/value", err)
+	}
+	err = db.Put([]byte("mykey1"), []byte("myvalue1"))
+	if err != nil {
+		t.Fatal("unable to put key/value", err)
+	}
+	err = db.CloseWithMerge(1)
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+
+	// reopen so the values are read from the disk segment
+	db, err = leveldb.Open("test/mydb", options)
+	if err != nil {
+		t.Fatal("unable to open database", err)
+	}
+	s, err := db.Snapshot()
+	if err != nil {
+		t.Fatal("unable to get snapshot", err)
+	}
+	_, err = db.Remove([]byte("mykey"))
+	if err != nil {
+		t.Fatal("unable to remove key", err)
+	}
+
+	val, err := s.GetUnsafe([]byte("mykey"))
+	if err != nil {
+		t.Fatal("unable to get key/value", err)
+	}
+	if !bytes.Equal([]byte("myvalue"), val) {
+		t.Fatal("value does not match")
+	}
+	_, err = s.GetUnsafe([]byte("mykey2"))
+	if err != leveldb.KeyNotFound {
+		t.Fatal("should have returned KeyNotFound", err)
+	}
+
+	itr, err := s.LookupUnsafe([]byte("mykey1"), nil)
+	if err != nil {
+		t.Fatal("unable to lookup() on snapshot", err)
+	}
+	k, v, err := itr.Next()
+	if err != nil {
+		t.Fatal("unable to Next()", err)
+	}
+	if !bytes.Equal([]byte("mykey1"), k) || !bytes.Equal([]byte("myvalue1"), v) {
+		t.Fatal("key/value does not match")
+	}
+	_, _, err = itr.Next()
+	if err != leveldb.EndOfIterator {
+		t.Fatal("should of seen EndOfIterator")
+	}
+
+	s.Close()
+	_, err = s.GetUnsafe([]byte("mykey"))
+	if err != leveldb.SnapshotClosed {
+		t.Fatal("should have been closed", err)
+	}
+	db.Close()
+}
+
+func TestSnapshot_ReadOptions(t *testing.T) {
+	leveldb.Remove("test/mydb")
+
+	db, err := leveldb.Open("test/mydb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	err = db.Put([]byte("mykey"), []byte("myvalue"))
+	if err != nil {
+		t.Fatal("unable to put key/value", err)
+	}
+	s, err := db.Snapshot()
+	if err != nil {
+		t.Fatal("unable to get snapshot", err)
+	}
+	err = db.Put([]byte("mykey"), []byte("myvalue1"))
+	if err != nil {
+		t.Fatal("unable to put key/value", err)
+	}
+
+	val, err := db.GetWithOptions([]byte("mykey"), leveldb.ReadOptions{Snapshot: s})
+	if err != nil || !bytes.Equal([]byte("myvalue"), val) {
+		t.Fatal("snapshot value does not match", string(val), err)
+	}
+	val, err = db.GetWithOptions([]byte("mykey"), leveldb.ReadOptions{})
+	if err != nil || !bytes.Equal([]byte("myvalue1"), val) {
+		t.Fatal("value does not match", string(val), err)
+	}
+
+	itr, err := db.LookupWithOptions(nil, nil, leveldb.ReadOptions{Snapshot: s})
+	if err != nil {
+		t.Fatal("unable to lookup", err)
+	}
+	_, v, err := itr.Next()
+	if err != nil || !bytes.Equal([]byte("myvalue"), v) {
+		t.Fatal("snapshot value does not match", string(v), err)
+	}
+	_, _, err = itr.Next()
+	if err != leveldb.EndOfIterator {
+		t.Fatal("should of seen EndOfIterator")
+	}
+	s.Close()
+	db.Close()
+}
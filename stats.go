@@ -0,0 +1,240 @@
+package leveldb
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// number of histogram buckets, the upper bound of bucket i is 2^i microseconds, and the last bucket is unbounded
+const histogramBuckets = 24
+
+// Statistics are the counters and gauges of a database, see Database.Stats. The counters are collected since the
+// database was opened, or since the last ResetStats.
+type Statistics struct {
+	NumberOfSegments int
+
+	// operation latencies, which include the number of operations
+	GetLatency    Histogram
+	PutLatency    Histogram
+	WriteLatency  Histogram
+	LookupLatency Histogram
+
+	// bytes of the keys and values written by Put, Remove and Write
+	BytesWritten uint64
+	// bytes appended to the write ahead logs
+	WALBytesWritten uint64
+	// number of memory and log segments written to disk, and the size of the disk segments
+	Flushes           uint64
+	FlushBytesWritten uint64
+	// number of merges, their total duration, and the size of the merged and resulting segments
+	Merges            uint64
+	MergeTime         time.Duration
+	MergeBytesRead    uint64
+	MergeBytesWritten uint64
+	// bytes written to disk per byte written by the user
+	WriteAmplification float64
+
+	// number of times producers were paused waiting for the flusher, and the total time paused
+	Stalls    uint64
+	StallTime time.Duration
+
+	// size of the current memory segment
+	MemtableBytes uint64
+	// number and size of the segments by type, MemorySegments includes the current memory segment
+	MemorySegments     int
+	MemorySegmentBytes uint64
+	LogSegments        int
+	LogSegmentBytes    uint64
+	DiskSegments       int
+	DiskSegmentBytes   uint64
+	// number of open snapshots
+	Snapshots int
+}
+
+// Histogram is a snapshot of a latency histogram with exponentially sized buckets
+type Histogram struct {
+	Count uint64
+	Sum   time.Duration
+	Max   time.Duration
+	// Buckets[i] is the number of observations greater than the upper bound of bucket i-1, and less than or
+	// equal to BucketUpperBound(i)
+	Buckets [histogramBuckets]uint64
+}
+
+// BucketUpperBound returns the upper bound of bucket i, the last bucket has no upper bound
+func BucketUpperBound(i int) time.Duration {
+	if i >= histogramBuckets-1 {
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Duration(1<<i) * time.Microsecond
+}
+
+// Mean returns the mean latency
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Percentile returns an approximation of the latency at percentile p, between 0 and 100, which is the upper
+// bound of the bucket containing it, or the maximum latency for the last bucket
+func (h Histogram) Percentile(p float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := uint64(p / 100 * float64(h.Count))
+	n := uint64(0)
+	for i, count := range h.Buckets {
+		n += count
+		if n > rank || (n == h.Count && count > 0) {
+			if bound := BucketUpperBound(i); bound < h.Max {
+				return bound
+			}
+			return h.Max
+		}
+	}
+	return h.Max
+}
+
+// histogram collects latencies using atomic counters
+type histogram struct {
+	count   uint64
+	sum     int64
+	max     int64
+	buckets [histogramBuckets]uint64
+}
+
+// since records the time elapsed since start
+func (h *histogram) since(start time.Time) {
+	h.observe(time.Since(start))
+}
+
+func (h *histogram) observe(d time.Duration) {
+	micros := uint64((d + time.Microsecond - 1) / time.Microsecond)
+	i := 0
+	if micros > 1 {
+		i = bits.Len64(micros - 1)
+	}
+	if i >= histogramBuckets {
+		i = histogramBuckets - 1
+	}
+	atomic.AddUint64(&h.buckets[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddInt64(&h.sum, int64(d))
+	for {
+		max := atomic.LoadInt64(&h.max)
+		if int64(d) <= max || atomic.CompareAndSwapInt64(&h.max, max, int64(d)) {
+			break
+		}
+	}
+}
+
+func (h *histogram) snapshot() Histogram {
+	s := Histogram{
+		Count: atomic.LoadUint64(&h.count),
+		Sum:   time.Duration(atomic.LoadInt64(&h.sum)),
+		Max:   time.Duration(atomic.LoadInt64(&h.max)),
+	}
+	for i := range h.buckets {
+		s.Buckets[i] = atomic.LoadUint64(&h.buckets[i])
+	}
+	return s
+}
+
+func (h *histogram) reset() {
+	atomic.StoreUint64(&h.count, 0)
+	atomic.StoreInt64(&h.sum, 0)
+	atomic.StoreInt64(&h.max, 0)
+	for i := range h.buckets {
+		atomic.StoreUint64(&h.buckets[i], 0)
+	}
+}
+
+// statistics are the counters of a database, which are atomically updated
+type statistics struct {
+	gets    histogram
+	puts    histogram
+	writes  histogram
+	lookups histogram
+
+	bytesWritten      uint64
+	walBytesWritten   uint64
+	flushes           uint64
+	flushBytesWritten uint64
+	merges            uint64
+	mergeTime         int64
+	mergeBytesRead    uint64
+	mergeBytesWritten uint64
+	stalls            uint64
+	stallTime         int64
+}
+
+func (s *statistics) reset() {
+	s.gets.reset()
+	s.puts.reset()
+	s.writes.reset()
+	s.lookups.reset()
+	for _, counter := range []*uint64{&s.bytesWritten, &s.walBytesWritten, &s.flushes, &s.flushBytesWritten, &s.merges, &s.mergeBytesRead, &s.mergeBytesWritten, &s.stalls} {
+		atomic.StoreUint64(counter, 0)
+	}
+	atomic.StoreInt64(&s.mergeTime, 0)
+	atomic.StoreInt64(&s.stallTime, 0)
+}
+
+// Stats returns the statistics of the database
+func (db *Database) Stats() Statistics {
+	db.Lock()
+	snapshots := len(db.snapshots)
+	db.Unlock()
+
+	s := &db.stats
+	stats := Statistics{
+		GetLatency:        s.gets.snapshot(),
+		PutLatency:        s.puts.snapshot(),
+		WriteLatency:      s.writes.snapshot(),
+		LookupLatency:     s.lookups.snapshot(),
+		BytesWritten:      atomic.LoadUint64(&s.bytesWritten),
+		WALBytesWritten:   atomic.LoadUint64(&s.walBytesWritten),
+		Flushes:           atomic.LoadUint64(&s.flushes),
+		FlushBytesWritten: atomic.LoadUint64(&s.flushBytesWritten),
+		Merges:            atomic.LoadUint64(&s.merges),
+		MergeTime:         time.Duration(atomic.LoadInt64(&s.mergeTime)),
+		MergeBytesRead:    atomic.LoadUint64(&s.mergeBytesRead),
+		MergeBytesWritten: atomic.LoadUint64(&s.mergeBytesWritten),
+		Stalls:            atomic.LoadUint64(&s.stalls),
+		StallTime:         time.Duration(atomic.LoadInt64(&s.stallTime)),
+		Snapshots:         snapshots,
+	}
+	if stats.BytesWritten > 0 {
+		stats.WriteAmplification = float64(stats.WALBytesWritten+stats.FlushBytesWritten+stats.MergeBytesWritten) / float64(stats.BytesWritten)
+	}
+
+	state := db.getState()
+	stats.NumberOfSegments = len(state.segments)
+	segments := state.segments
+	if state.memory != nil {
+		stats.MemtableBytes = state.memory.size()
+		segments = copyAndAppend(segments, state.memory)
+	}
+	for _, seg := range segments {
+		switch seg.(type) {
+		case *memorySegment:
+			stats.MemorySegments++
+			stats.MemorySegmentBytes += seg.size()
+		case *logSegment:
+			stats.LogSegments++
+			stats.LogSegmentBytes += seg.size()
+		case *diskSegment:
+			stats.DiskSegments++
+			stats.DiskSegmentBytes += seg.size()
+		}
+	}
+	return stats
+}
+
+// ResetStats resets the counters and latency histograms of the database
+func (db *Database) ResetStats() {
+	db.stats.reset()
+}
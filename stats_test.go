@@ -0,0 +1,116 @@
+package leveldb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	options := Options{CreateIfNeeded: true, DisableAutoMerge: true, FileSystem: NewMemFileSystem()}
+
+	db, err := Open("test/statsdb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+	for i := 0; i < 1000; i++ {
+		err = db.Put([]byte(fmt.Sprint("mykey", i)), []byte(fmt.Sprint("myvalue", i)))
+		if err != nil {
+			t.Fatal("unable to put key/value", err)
+		}
+	}
+	wb := WriteBatch{}
+	wb.Put([]byte("batchkey"), []byte("batchvalue"))
+	err = db.Write(wb)
+	if err != nil {
+		t.Fatal("unable to write batch", err)
+	}
+	_, err = db.Get([]byte("mykey1"))
+	if err != nil {
+		t.Fatal("unable to get", err)
+	}
+
+	stats := db.Stats()
+	if stats.PutLatency.Count != 1000 || stats.WriteLatency.Count != 1 || stats.GetLatency.Count != 1 {
+		t.Fatal("incorrect operation counts", stats.PutLatency.Count, stats.WriteLatency.Count, stats.GetLatency.Count)
+	}
+	if stats.BytesWritten == 0 || stats.WALBytesWritten <= stats.BytesWritten {
+		t.Fatal("incorrect bytes written", stats.BytesWritten, stats.WALBytesWritten)
+	}
+	if stats.MemtableBytes == 0 || stats.MemorySegments != 1 || stats.DiskSegments != 0 {
+		t.Fatal("incorrect memory segment stats", stats)
+	}
+
+	// write two disk segments and merge them
+	for i := 0; i < 2; i++ {
+		_, err = db.Lookup(nil, nil)
+		if err != nil {
+			t.Fatal("unable to lookup", err)
+		}
+		err = db.Put([]byte("mykey"), []byte("myvalue"))
+		if err != nil {
+			t.Fatal("unable to put key/value", err)
+		}
+		err = db.flushMemory()
+		if err != nil {
+			t.Fatal("unable to flush memory", err)
+		}
+		waitForFlush(t, db)
+	}
+	stats = db.Stats()
+	if stats.Flushes < 2 || stats.FlushBytesWritten == 0 || stats.DiskSegments < 2 || stats.DiskSegmentBytes == 0 {
+		t.Fatal("incorrect flush stats", stats.Flushes, stats.FlushBytesWritten, stats.DiskSegments)
+	}
+	if stats.LookupLatency.Count != 2 || stats.Snapshots != 2 {
+		t.Fatal("incorrect lookup stats", stats.LookupLatency.Count, stats.Snapshots)
+	}
+
+	err = mergeSegments0(db, 1, false)
+	if err != nil {
+		t.Fatal("unable to merge", err)
+	}
+	stats = db.Stats()
+	if stats.Merges == 0 || stats.MergeBytesRead == 0 || stats.MergeBytesWritten == 0 || stats.DiskSegments != 1 {
+		t.Fatal("incorrect merge stats", stats.Merges, stats.MergeBytesRead, stats.MergeBytesWritten, stats.DiskSegments)
+	}
+	if stats.WriteAmplification <= 1 {
+		t.Fatal("incorrect write amplification", stats.WriteAmplification)
+	}
+
+	db.ResetStats()
+	stats = db.Stats()
+	if stats.PutLatency.Count != 0 || stats.BytesWritten != 0 || stats.Merges != 0 || stats.DiskSegments != 1 {
+		t.Fatal("counters should be reset", stats)
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := histogram{}
+	for i := 0; i < 90; i++ {
+		h.observe(3 * time.Microsecond)
+	}
+	for i := 0; i < 10; i++ {
+		h.observe(time.Millisecond)
+	}
+	s := h.snapshot()
+	if s.Count != 100 || s.Max != time.Millisecond {
+		t.Fatal("incorrect count or max", s.Count, s.Max)
+	}
+	if s.Buckets[2] != 90 {
+		t.Fatal("incorrect bucket", s.Buckets)
+	}
+	if p := s.Percentile(50); p != 4*time.Microsecond {
+		t.Fatal("incorrect median", p)
+	}
+	if p := s.Percentile(99); p != time.Millisecond {
+		t.Fatal("incorrect 99th percentile", p)
+	}
+	if m := s.Mean(); m != (90*3*time.Microsecond+10*time.Millisecond)/100 {
+		t.Fatal("incorrect mean", m)
+	}
+}
@@ -0,0 +1,103 @@
+package leveldb
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// WriteBufferManager limits the total memory used by the memory segments of all databases that share it via
+// Options.WriteBufferManager. When the limit is exceeded, the largest memory segment is made immutable so that it
+// is written to disk by the background flusher of its database. Only the active memory segments count against the
+// limit, the immutable segments waiting to be written are bounded by Options.MaxImmutableMemtables.
+type WriteBufferManager struct {
+	mu         sync.Mutex
+	bufferSize uint64
+	dbs        map[*Database]bool
+	// bytes used by the active memory segments, atomically updated by the writers
+	usage int64
+	// held by the writer that flushes the largest memory segment
+	flushMu sync.Mutex
+}
+
+// NewWriteBufferManager returns a WriteBufferManager that limits the total memory of the memory segments to
+// bufferSize bytes.
+func NewWriteBufferManager(bufferSize uint64) *WriteBufferManager {
+	return &WriteBufferManager{bufferSize: bufferSize, dbs: make(map[*Database]bool)}
+}
+
+// BufferSize returns the memory limit in bytes
+func (m *WriteBufferManager) BufferSize() uint64 {
+	return m.bufferSize
+}
+
+// MemoryUsage returns the number of bytes used by the memory segments, and the immutable segments waiting to be
+// written to disk, of all open databases that share the manager.
+func (m *WriteBufferManager) MemoryUsage() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := uint64(0)
+	for db := range m.dbs {
+		usage += db.memoryUsage()
+	}
+	return usage
+}
+
+func (m *WriteBufferManager) register(db *Database) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dbs[db] = true
+}
+
+func (m *WriteBufferManager) unregister(db *Database) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.dbs, db)
+	m.release(db)
+}
+
+// charge updates the usage with the size of the active memory segment of the database
+func (m *WriteBufferManager) charge(db *Database) {
+	size := db.getState().memory.size()
+	atomic.AddInt64(&m.usage, int64(size)-int64(atomic.SwapUint64(&db.wbmBytes, size)))
+}
+
+// release removes the memory segment of the database from the usage, once it is immutable or the database is closed
+func (m *WriteBufferManager) release(db *Database) {
+	atomic.AddInt64(&m.usage, -int64(atomic.SwapUint64(&db.wbmBytes, 0)))
+}
+
+// maybeFlush updates the usage after a write to the database, and makes the largest memory segment immutable if
+// the memory limit is exceeded. The caller must not hold the lock of any database.
+func (m *WriteBufferManager) maybeFlush(db *Database) {
+	m.charge(db)
+	if atomic.LoadInt64(&m.usage) <= int64(m.bufferSize) {
+		return
+	}
+	// a single writer flushes, the others continue since the usage is reduced once the segment is immutable
+	if !m.flushMu.TryLock() {
+		return
+	}
+	defer m.flushMu.Unlock()
+	if atomic.LoadInt64(&m.usage) <= int64(m.bufferSize) {
+		return
+	}
+
+	m.mu.Lock()
+	var largest *Database
+	size := uint64(0)
+	for db := range m.dbs {
+		if unflushedSegments(db.getState().segments) >= db.getOptions().MaxImmutableMemtables {
+			// the database already has a flush pending, and making another segment immutable would stall its writers
+			continue
+		}
+		if n := atomic.LoadUint64(&db.wbmBytes); n > size {
+			largest, size = db, n
+		}
+	}
+	m.mu.Unlock()
+
+	if largest != nil {
+		// an error is reported to the writers of the database
+		largest.flushMemory()
+	}
+}
@@ -0,0 +1,97 @@
+package leveldb
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWriteBufferManager(t *testing.T) {
+	wbm := NewWriteBufferManager(2 * 1024 * 1024)
+
+	dbs := make([]*Database, 4)
+	for i := range dbs {
+		options := Options{CreateIfNeeded: true, DisableAutoMerge: true, FileSystem: NewMemFileSystem(), WriteBufferManager: wbm}
+		db, err := Open(fmt.Sprint("test/wbmdb", i), options)
+		if err != nil {
+			t.Fatal("unable to create database", err)
+		}
+		dbs[i] = db
+	}
+
+	// each database holds less than MaxMemoryBytes, but the total exceeds the buffer size
+	for i := 0; i < 5000; i++ {
+		for _, db := range dbs {
+			err := db.Put([]byte(fmt.Sprint("mykey", i)), []byte(fmt.Sprint("myvalue", i)))
+			if err != nil {
+				t.Fatal("unable to put key/value", err)
+			}
+		}
+	}
+	for _, db := range dbs {
+		waitForFlush(t, db)
+	}
+	if usage := wbm.MemoryUsage(); usage > wbm.BufferSize() {
+		t.Fatal("memory usage exceeds buffer size", usage)
+	}
+
+	flushed := 0
+	for _, db := range dbs {
+		if len(db.getState().segments) > 0 {
+			flushed++
+		}
+		value, err := db.Get([]byte("mykey4999"))
+		if err != nil || string(value) != "myvalue4999" {
+			t.Fatal("incorrect value", string(value), err)
+		}
+	}
+	if flushed == 0 {
+		t.Fatal("memory segments should have been flushed")
+	}
+
+	for _, db := range dbs {
+		err := db.Close()
+		if err != nil {
+			t.Fatal("unable to close database", err)
+		}
+	}
+	if usage := wbm.MemoryUsage(); usage != 0 {
+		t.Fatal("closed databases should not use memory", usage)
+	}
+}
+
+func TestWriteBufferManager_ImmutableSegments(t *testing.T) {
+	wbm := NewWriteBufferManager(1024 * 1024)
+
+	options := Options{CreateIfNeeded: true, DisableAutoMerge: true, FileSystem: NewMemFileSystem(), WriteBufferManager: wbm}
+	db, err := Open("test/wbmdb", options)
+	if err != nil {
+		t.Fatal("unable to create database", err)
+	}
+
+	// the immutable segments waiting to be written do not count against the limit, so the memory segment is only
+	// made immutable once it is full
+	for i := 0; i < 50000; i++ {
+		err := db.Put([]byte(fmt.Sprint("mykey", i)), []byte(fmt.Sprint("myvalue", i)))
+		if err != nil {
+			t.Fatal("unable to put key/value", err)
+		}
+	}
+	waitForFlush(t, db)
+
+	usage := atomic.LoadInt64(&wbm.usage)
+	if usage < 0 || uint64(usage) > wbm.BufferSize() {
+		t.Fatal("incorrect usage", usage)
+	}
+	if flushes := db.Stats().Flushes; flushes == 0 || flushes > 20 {
+		t.Fatal("incorrect number of flushes", flushes)
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal("unable to close database", err)
+	}
+	if usage := atomic.LoadInt64(&wbm.usage); usage != 0 {
+		t.Fatal("closed database should not use memory", usage)
+	}
+}